@@ -0,0 +1,90 @@
+package tcping
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// ErrSockoptUnsupported is returned when Interface, TOS, TTL or Mark is
+// set on a platform where they are not implemented.
+var ErrSockoptUnsupported = errors.New("interface binding and socket options are only supported on Linux")
+
+// ParseSourceAddr parses Config.Source: an IP address, optionally with a
+// port ("192.0.2.10", "192.0.2.10:40000", "[2001:db8::1]:40000"). An empty
+// string returns nil.
+func ParseSourceAddr(s string) (*net.TCPAddr, error) {
+	if s == "" {
+		return nil, nil
+	}
+	host, port := s, "0"
+	if h, p, err := net.SplitHostPort(s); err == nil {
+		host, port = h, p
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, fmt.Errorf("source %q is not an IP address", s)
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 0 || n > 65535 {
+		return nil, fmt.Errorf("source %q has an invalid port", s)
+	}
+	return &net.TCPAddr{IP: ip, Port: n}, nil
+}
+
+// newDialer builds the dialer used for every probe from Source and the
+// socket options.
+func (c *Config) newDialer() (*net.Dialer, error) {
+	d := &net.Dialer{}
+	src, err := ParseSourceAddr(c.Source)
+	if err != nil {
+		return nil, err
+	}
+	if src != nil {
+		d.LocalAddr = src
+	}
+	if c.Interface != "" || c.TOS != 0 || c.TTL != 0 || c.Mark != 0 {
+		d.Control = c.control
+	}
+	return d, nil
+}
+
+// control runs on the raw socket before connect. network is "tcp4" or
+// "tcp6", which decides between the IPv4 and IPv6 option levels.
+func (c *Config) control(network, _ string, rc syscall.RawConn) error {
+	var opErr error
+	err := rc.Control(func(fd uintptr) {
+		opErr = c.setSockopts(fd, strings.HasSuffix(network, "6"))
+	})
+	if err != nil {
+		return err
+	}
+	return opErr
+}
+
+func (c *Config) setSockopts(fd uintptr, ipv6 bool) error {
+	if c.Interface != "" {
+		if err := bindToDevice(fd, c.Interface); err != nil {
+			return err
+		}
+	}
+	if c.TOS != 0 {
+		if err := setTOS(fd, ipv6, c.TOS); err != nil {
+			return err
+		}
+	}
+	if c.TTL != 0 {
+		if err := setTTL(fd, ipv6, c.TTL); err != nil {
+			return err
+		}
+	}
+	if c.Mark != 0 {
+		if err := setMark(fd, c.Mark); err != nil {
+			return err
+		}
+	}
+	return nil
+}
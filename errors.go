@@ -0,0 +1,147 @@
+package tcping
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// Errors wrapped by ResolveError.
+var (
+	ErrNotIPv4       = errors.New("not an IPv4 address")
+	ErrNotIPv6       = errors.New("not an IPv6 address")
+	ErrNoAddress     = errors.New("no IP address found")
+	ErrNoIPv4Address = errors.New("no IPv4 address found")
+	ErrNoIPv6Address = errors.New("no IPv6 address found")
+)
+
+// ResolveError is returned when the target host cannot be turned into an
+// address to probe.
+type ResolveError struct {
+	Host   string
+	Server string // DNS server used, empty for the system resolver
+	Err    error
+}
+
+func (e *ResolveError) Error() string {
+	if e.Server != "" {
+		return fmt.Sprintf("resolve %s via %s: %v", e.Host, e.Server, e.Err)
+	}
+	return fmt.Sprintf("resolve %s: %v", e.Host, e.Err)
+}
+
+func (e *ResolveError) Unwrap() error { return e.Err }
+
+// TLSError marks a handshake failure after the TCP connect succeeded.
+type TLSError struct{ Err error }
+
+func (e *TLSError) Error() string { return "tls handshake: " + e.Err.Error() }
+func (e *TLSError) Unwrap() error { return e.Err }
+
+func IsTLSError(err error) bool {
+	var te *TLSError
+	return errors.As(err, &te)
+}
+
+// HTTPError wraps a transport failure after the TCP (and TLS) stage.
+type HTTPError struct{ Err error }
+
+func (e *HTTPError) Error() string { return "http request: " + e.Err.Error() }
+func (e *HTTPError) Unwrap() error { return e.Err }
+
+// HTTPStatusError is returned when the response code is outside HTTPExpect.
+type HTTPStatusError struct{ Code int }
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("http status %d not in expected range", e.Code)
+}
+
+// RecordedError stands in for a probe error read back from a log, whose
+// class was already determined when the log was written.
+type RecordedError struct {
+	Class string // one of the ErrClass constants
+	Text  string
+}
+
+func (e *RecordedError) Error() string { return e.Text }
+
+// =====================
+// Error classification
+// =====================
+
+// Error classes returned by ClassifyError.
+const (
+	ErrClassTimeout         = "timeout"
+	ErrClassRefused         = "refused"
+	ErrClassHostUnreachable = "host_unreachable"
+	ErrClassNetUnreachable  = "net_unreachable"
+	ErrClassReset           = "reset"
+	ErrClassDNS             = "dns"
+	ErrClassPermission      = "permission"
+	ErrClassTLS             = "tls"
+	ErrClassHTTPStatus      = "http_status"
+	ErrClassHTTP            = "http"
+	ErrClassOther           = "other"
+)
+
+// Winsock reports its own errno values, which the syscall constants used
+// on Unix do not match; compare them numerically so this builds everywhere.
+const (
+	wsaEACCES       = syscall.Errno(10013)
+	wsaENETUNREACH  = syscall.Errno(10051)
+	wsaECONNRESET   = syscall.Errno(10054)
+	wsaETIMEDOUT    = syscall.Errno(10060)
+	wsaECONNREFUSED = syscall.Errno(10061)
+	wsaEHOSTUNREACH = syscall.Errno(10065)
+)
+
+// ClassifyError maps a probe error to a short, stable class name used in
+// CSV, JSON, metrics and the summary. Failures after connect are classified
+// by stage first so a slow TLS handshake is not reported as a dial timeout.
+func ClassifyError(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	var re *RecordedError
+	if errors.As(err, &re) {
+		return re.Class
+	}
+
+	switch {
+	case IsTLSError(err):
+		return ErrClassTLS
+	case errors.As(err, new(*HTTPStatusError)):
+		return ErrClassHTTPStatus
+	case errors.As(err, new(*HTTPError)):
+		return ErrClassHTTP
+	case errors.As(err, new(*net.DNSError)), errors.As(err, new(*ResolveError)):
+		return ErrClassDNS
+	}
+
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		switch errno {
+		case syscall.ETIMEDOUT, wsaETIMEDOUT:
+			return ErrClassTimeout
+		case syscall.ECONNREFUSED, wsaECONNREFUSED:
+			return ErrClassRefused
+		case syscall.EHOSTUNREACH, wsaEHOSTUNREACH:
+			return ErrClassHostUnreachable
+		case syscall.ENETUNREACH, wsaENETUNREACH:
+			return ErrClassNetUnreachable
+		case syscall.ECONNRESET, wsaECONNRESET:
+			return ErrClassReset
+		case syscall.EACCES, syscall.EPERM, wsaEACCES:
+			return ErrClassPermission
+		}
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrClassTimeout
+	}
+	return ErrClassOther
+}
@@ -0,0 +1,19 @@
+//go:build linux && !386
+
+package tcping
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// getsockopt is the raw system call, which the syscall package only
+// exposes for a few fixed option types.
+func getsockopt(fd uintptr, level, opt int, val unsafe.Pointer, size *uint32) error {
+	_, _, errno := syscall.Syscall6(syscall.SYS_GETSOCKOPT, fd, uintptr(level), uintptr(opt),
+		uintptr(val), uintptr(unsafe.Pointer(size)), 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,19 @@
+package tcping
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// sysGetsockopt is the socketcall(2) multiplexer number for getsockopt;
+// linux/386 has no direct system call for it.
+const sysGetsockopt = 15
+
+func getsockopt(fd uintptr, level, opt int, val unsafe.Pointer, size *uint32) error {
+	args := [5]uintptr{fd, uintptr(level), uintptr(opt), uintptr(val), uintptr(unsafe.Pointer(size))}
+	_, _, errno := syscall.Syscall(syscall.SYS_SOCKETCALL, sysGetsockopt, uintptr(unsafe.Pointer(&args)), 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -1,3 +1,3 @@
-module tcping
+module github.com/nodeseeker/tcping
 
 go 1.26.1
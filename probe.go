@@ -0,0 +1,296 @@
+package tcping
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"time"
+)
+
+// =====================
+// TLS probe
+// =====================
+
+// TLSInfo describes the handshake of a probe in TLS mode. Only Handshake
+// is set when the handshake failed.
+type TLSInfo struct {
+	Handshake  time.Duration
+	Version    string
+	Cipher     string
+	ALPN       string
+	CertExpiry time.Time // leaf certificate NotAfter
+}
+
+func (r *Runner) tlsConfig() *tls.Config {
+	return &tls.Config{
+		ServerName:         r.ServerName(),
+		NextProtos:         r.cfg.ALPN,
+		InsecureSkipVerify: r.cfg.TLSInsecure,
+	}
+}
+
+// tlsHandshake upgrades conn and times the handshake under its own
+// Timeout budget. The returned conn is always the one to close.
+func (r *Runner) tlsHandshake(ctx context.Context, conn net.Conn) (net.Conn, *TLSInfo, error) {
+	cfg := r.tlsConfig()
+
+	hsCtx, cancel := context.WithTimeout(ctx, r.cfg.Timeout)
+	defer cancel()
+
+	tc := tls.Client(conn, cfg)
+	start := time.Now()
+	err := tc.HandshakeContext(hsCtx)
+	res := &TLSInfo{Handshake: time.Since(start)}
+	if err != nil {
+		return tc, res, &TLSError{Err: err}
+	}
+
+	res.fill(tc.ConnectionState())
+	return tc, res, nil
+}
+
+func (t *TLSInfo) fill(cs tls.ConnectionState) {
+	t.Version = tls.VersionName(cs.Version)
+	t.Cipher = tls.CipherSuiteName(cs.CipherSuite)
+	t.ALPN = cs.NegotiatedProtocol
+	if len(cs.PeerCertificates) > 0 {
+		t.CertExpiry = cs.PeerCertificates[0].NotAfter
+	}
+}
+
+// =====================
+// HTTP probe
+// =====================
+
+// HTTPInfo describes the request of a probe in HTTP mode. Status is zero
+// when no response arrived.
+type HTTPInfo struct {
+	Status int
+	DNS    time.Duration // this probe's lookup of the host, zero for IP targets
+	TTFB   time.Duration // request written -> first response byte
+	Total  time.Duration // lookup start -> response body drained
+}
+
+// StatusRange is an inclusive range of HTTP status codes.
+type StatusRange struct{ Lo, Hi int }
+
+// HTTPSnapshot summarizes the responses of a Runner in HTTP mode.
+type HTTPSnapshot struct {
+	Status map[int]int64 // responses by status code
+	DNS    StatsSnapshot
+	TTFB   StatsSnapshot
+	Total  StatsSnapshot
+}
+
+type httpStats struct {
+	mu     sync.Mutex
+	status map[int]int64
+
+	dns   Statistics
+	ttfb  Statistics
+	total Statistics
+}
+
+// record counts a probe that got a response; transport failures have no
+// status and are already counted as loss in the main Statistics. The
+// lookup of every probe is kept, failed ones as DNS loss.
+func (h *httpStats) record(res *HTTPInfo, err error) {
+	if res.DNS > 0 {
+		var dnsErr error
+		if errors.As(err, new(*ResolveError)) {
+			dnsErr = err
+		}
+		h.dns.Update(res.DNS, dnsErr)
+	}
+	if res.Status == 0 {
+		return
+	}
+	h.mu.Lock()
+	if h.status == nil {
+		h.status = make(map[int]int64)
+	}
+	h.status[res.Status]++
+	h.mu.Unlock()
+
+	h.ttfb.Update(res.TTFB, nil)
+	h.total.Update(res.Total, nil)
+}
+
+func (h *httpStats) snapshot() HTTPSnapshot {
+	h.mu.Lock()
+	status := make(map[int]int64, len(h.status))
+	for code, n := range h.status {
+		status[code] = n
+	}
+	h.mu.Unlock()
+	return HTTPSnapshot{Status: status, DNS: h.dns.Snapshot(), TTFB: h.ttfb.Snapshot(), Total: h.total.Snapshot()}
+}
+
+func statusAllowed(code int, ranges []StatusRange) bool {
+	for _, sr := range ranges {
+		if code >= sr.Lo && code <= sr.Hi {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Runner) newHTTPRequest(ctx context.Context) (*http.Request, error) {
+	scheme := "http"
+	if r.cfg.TLS {
+		scheme = "https"
+	}
+	path := r.cfg.HTTPPath
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	req, err := http.NewRequestWithContext(ctx, r.cfg.HTTPMethod, scheme+"://"+net.JoinHostPort(r.host, r.port)+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", r.cfg.UserAgent)
+	for name, values := range r.cfg.HTTPHeader {
+		if strings.EqualFold(name, "Host") {
+			req.Host = values[len(values)-1]
+			continue
+		}
+		for _, v := range values {
+			req.Header.Add(name, v)
+		}
+	}
+	if r.cfg.HTTPHost != "" {
+		req.Host = r.cfg.HTTPHost
+	}
+	return req, nil
+}
+
+// httpTrace collects the httptrace callbacks of one request. The transport
+// calls them from its own goroutines, which may still be running when
+// RoundTrip gives up on a timeout.
+type httpTrace struct {
+	mu               sync.Mutex
+	tlsInfo          *TLSInfo
+	tlsErr           error
+	tlsStart         time.Time
+	wrote, firstByte time.Time
+}
+
+func (t *httpTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		TLSHandshakeStart: func() {
+			t.mu.Lock()
+			t.tlsStart = time.Now()
+			t.mu.Unlock()
+		},
+		TLSHandshakeDone: func(cs tls.ConnectionState, err error) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.tlsInfo = &TLSInfo{Handshake: time.Since(t.tlsStart)}
+			if err != nil {
+				t.tlsErr = &TLSError{Err: err}
+				return
+			}
+			t.tlsInfo.fill(cs)
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			t.mu.Lock()
+			t.wrote = time.Now()
+			t.mu.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			t.mu.Lock()
+			t.firstByte = time.Now()
+			t.mu.Unlock()
+		},
+	}
+}
+
+// oneShotConn hands conn to the transport at most once and closes it
+// exactly once, whether the transport or httpProbe gets there first.
+type oneShotConn struct {
+	net.Conn
+
+	mu        sync.Mutex
+	handedOut bool
+	closed    bool
+}
+
+func (c *oneShotConn) dial(context.Context, string, string) (net.Conn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.handedOut || c.closed {
+		return nil, errors.New("connection already used")
+	}
+	c.handedOut = true
+	return c, nil
+}
+
+func (c *oneShotConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	return c.Conn.Close()
+}
+
+// httpProbe sends one request over the already connected conn and traces
+// its phases. It always consumes conn. start is the lookup start time, or
+// the dial start for IP targets, so that Total covers the whole probe.
+func (r *Runner) httpProbe(ctx context.Context, conn net.Conn, start time.Time) (*HTTPInfo, *TLSInfo, error) {
+	reqCtx, cancel := context.WithTimeout(ctx, r.cfg.Timeout)
+	defer cancel()
+
+	oc := &oneShotConn{Conn: conn}
+	defer oc.Close()
+
+	var ht httpTrace
+	tlsCfg := r.tlsConfig()
+	tlsCfg.NextProtos = []string{"http/1.1"} // the one-shot transport speaks HTTP/1.1 only
+	tr := &http.Transport{
+		DialContext:       oc.dial,
+		TLSClientConfig:   tlsCfg,
+		DisableKeepAlives: true,
+	}
+	defer tr.CloseIdleConnections()
+
+	req, err := r.newHTTPRequest(httptrace.WithClientTrace(reqCtx, ht.clientTrace()))
+	if err != nil {
+		return &HTTPInfo{}, nil, &HTTPError{Err: err}
+	}
+
+	resp, err := tr.RoundTrip(req)
+	if err != nil {
+		// Close before reading the trace so that a dial still in flight
+		// can no longer hand the conn out.
+		_ = oc.Close()
+		ht.mu.Lock()
+		defer ht.mu.Unlock()
+		if ht.tlsErr != nil {
+			return &HTTPInfo{}, ht.tlsInfo, ht.tlsErr
+		}
+		return &HTTPInfo{}, ht.tlsInfo, &HTTPError{Err: err}
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	res := &HTTPInfo{Status: resp.StatusCode, Total: time.Since(start)}
+	ht.mu.Lock()
+	tlsInfo := ht.tlsInfo
+	if !ht.wrote.IsZero() && !ht.firstByte.IsZero() {
+		res.TTFB = ht.firstByte.Sub(ht.wrote)
+	}
+	ht.mu.Unlock()
+	if !statusAllowed(resp.StatusCode, r.cfg.HTTPExpect) {
+		return res, tlsInfo, &HTTPStatusError{Code: resp.StatusCode}
+	}
+	return res, tlsInfo, nil
+}
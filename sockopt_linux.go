@@ -0,0 +1,108 @@
+//go:build linux
+
+package tcping
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// bindToDevice restricts the socket to one interface, so it leaves through
+// that uplink whatever the routing table prefers.
+func bindToDevice(fd uintptr, name string) error {
+	if err := syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, name); err != nil {
+		return fmt.Errorf("bind to interface %s: %w", name, err)
+	}
+	return nil
+}
+
+// setTOS sets the IPv4 TOS byte or the IPv6 traffic class.
+func setTOS(fd uintptr, ipv6 bool, tos int) error {
+	level, opt := syscall.IPPROTO_IP, syscall.IP_TOS
+	if ipv6 {
+		level, opt = syscall.IPPROTO_IPV6, syscall.IPV6_TCLASS
+	}
+	if err := syscall.SetsockoptInt(int(fd), level, opt, tos); err != nil {
+		return fmt.Errorf("set TOS %#x: %w", tos, err)
+	}
+	return nil
+}
+
+// setTTL sets the IPv4 TTL or the IPv6 unicast hop limit.
+func setTTL(fd uintptr, ipv6 bool, ttl int) error {
+	level, opt := syscall.IPPROTO_IP, syscall.IP_TTL
+	if ipv6 {
+		level, opt = syscall.IPPROTO_IPV6, syscall.IPV6_UNICAST_HOPS
+	}
+	if err := syscall.SetsockoptInt(int(fd), level, opt, ttl); err != nil {
+		return fmt.Errorf("set TTL %d: %w", ttl, err)
+	}
+	return nil
+}
+
+// setMark sets SO_MARK for policy routing; it needs CAP_NET_ADMIN.
+func setMark(fd uintptr, mark uint32) error {
+	if err := syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_MARK, int(mark)); err != nil {
+		return fmt.Errorf("set mark %#x: %w", mark, err)
+	}
+	return nil
+}
+
+// getTCPInfo reads TCP_INFO. The kernel keeps no SYN-only counter, so
+// SYNRetransmits is tcpi_total_retrans as well: right after connect no
+// data has been sent, so every retransmission counted so far was a SYN.
+// Later reads go through refresh, which keeps that connect-time value.
+func getTCPInfo(fd uintptr) *TCPInfo {
+	var ti syscall.TCPInfo
+	size := uint32(unsafe.Sizeof(ti))
+	if getsockopt(fd, syscall.IPPROTO_TCP, syscall.TCP_INFO, unsafe.Pointer(&ti), &size) != nil {
+		return nil
+	}
+	return &TCPInfo{
+		SRTT:           time.Duration(ti.Rtt) * time.Microsecond,
+		RTTVar:         time.Duration(ti.Rttvar) * time.Microsecond,
+		Retransmits:    ti.Total_retrans,
+		SYNRetransmits: ti.Total_retrans,
+		MSS:            ti.Snd_mss,
+		PMTU:           ti.Pmtu,
+	}
+}
+
+// reservePort binds, without listening, a TCP socket to port on ip for a
+// SYN probe to send from. Port 0 picks an ephemeral port.
+func reservePort(ip net.IP, port int) (int, func(), error) {
+	family, sa := syscall.AF_INET6, syscall.Sockaddr(nil)
+	if ip4 := ip.To4(); ip4 != nil {
+		a := &syscall.SockaddrInet4{Port: port}
+		copy(a.Addr[:], ip4)
+		family, sa = syscall.AF_INET, a
+	} else {
+		a := &syscall.SockaddrInet6{Port: port}
+		copy(a.Addr[:], ip.To16())
+		sa = a
+	}
+
+	fd, err := syscall.Socket(family, syscall.SOCK_STREAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return 0, nil, err
+	}
+	if err := syscall.Bind(fd, sa); err != nil {
+		syscall.Close(fd)
+		return 0, nil, err
+	}
+	bound, err := syscall.Getsockname(fd)
+	if err != nil {
+		syscall.Close(fd)
+		return 0, nil, err
+	}
+	switch a := bound.(type) {
+	case *syscall.SockaddrInet4:
+		port = a.Port
+	case *syscall.SockaddrInet6:
+		port = a.Port
+	}
+	return port, func() { syscall.Close(fd) }, nil
+}
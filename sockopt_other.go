@@ -0,0 +1,12 @@
+//go:build !linux
+
+package tcping
+
+import "net"
+
+func bindToDevice(uintptr, string) error           { return ErrSockoptUnsupported }
+func setTOS(uintptr, bool, int) error              { return ErrSockoptUnsupported }
+func setTTL(uintptr, bool, int) error              { return ErrSockoptUnsupported }
+func setMark(uintptr, uint32) error                { return ErrSockoptUnsupported }
+func getTCPInfo(uintptr) *TCPInfo                  { return nil }
+func reservePort(net.IP, int) (int, func(), error) { return 0, nil, ErrSYNUnsupported }
@@ -0,0 +1,482 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nodeseeker/tcping"
+)
+
+// =====================
+// analyze subcommand
+// =====================
+
+const defaultAnalyzeBucket = time.Minute
+
+type analyzeOptions struct {
+	From, To time.Time // zero = unbounded
+	Hosts    []string
+	IPs      []string
+	Bucket   time.Duration
+	Format   string
+	Verbose  bool
+}
+
+// csvRecord is one probe read back from a CSV log written by -o.
+type csvRecord struct {
+	Time time.Time
+	Host string
+	IP   string
+	Port string
+	RTT  time.Duration
+	Err  error // nil for a successful probe
+
+	SYNRetransmit bool // from the syn_retransmit column, absent in older logs
+}
+
+// analyzeTarget rebuilds the statistics of one host:port from its records.
+type analyzeTarget struct {
+	host, port string
+
+	stats   tcping.Statistics
+	perIP   map[string]*tcping.Statistics
+	buckets map[time.Time]*tcping.Statistics
+}
+
+// runAnalyze implements `tcping analyze` and returns the exit code.
+func runAnalyze(args []string) int {
+	fs := flag.NewFlagSet("analyze", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var (
+		opts       analyzeOptions
+		from, to   string
+		hosts, ips string
+		langFlag   string
+		showHelp   bool
+	)
+	fs.StringVar(&from, "from", "", "")
+	fs.StringVar(&to, "to", "", "")
+	fs.StringVar(&hosts, "host", "", "")
+	fs.StringVar(&ips, "ip", "", "")
+	fs.DurationVar(&opts.Bucket, "bucket", defaultAnalyzeBucket, "")
+	fs.StringVar(&opts.Format, "format", formatText, "")
+	fs.BoolVar(&opts.Verbose, "v", false, "")
+	fs.BoolVar(&opts.Verbose, "verbose", false, "")
+	fs.StringVar(&langFlag, "lang", "", "")
+	fs.BoolVar(&showHelp, "h", false, "")
+	fs.BoolVar(&showHelp, "help", false, "")
+
+	if err := fs.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, msg("err.generic"), err)
+		return exitUsage
+	}
+	if langFlag != "" {
+		l, err := detectLang(langFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, msg("err.generic"), err)
+			return exitUsage
+		}
+		lang = l
+	}
+	if showHelp {
+		fmt.Printf(msg("analyze.help"), programName, version)
+		return exitOK
+	}
+	opts.Hosts = splitList(hosts)
+	opts.IPs = splitList(ips)
+
+	if err := opts.parse(from, to); err != nil {
+		fmt.Fprintf(os.Stderr, msg("err.generic"), err)
+		return exitUsage
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, msg("err.generic"), msg("err.analyze_files"))
+		return exitUsage
+	}
+
+	recs, err := readCSVLogs(fs.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, msg("err.generic"), err)
+		return exitError
+	}
+	recs = opts.filter(recs)
+	if len(recs) == 0 {
+		fmt.Fprintf(os.Stderr, msg("err.generic"), msg("err.analyze_empty"))
+		return exitError
+	}
+
+	targets := buildAnalyzeTargets(recs, opts.Bucket)
+	if opts.Format == formatJSON {
+		writeAnalyzeJSON(targets)
+	} else {
+		fmt.Printf(msg("analyze.loaded"), len(recs), len(fs.Args()),
+			formatDisplayTimestamp(recs[0].Time), formatDisplayTimestamp(recs[len(recs)-1].Time))
+		for _, t := range targets {
+			t.print(opts)
+		}
+	}
+	return exitOK
+}
+
+func (o *analyzeOptions) parse(from, to string) error {
+	var err error
+	if o.From, err = parseAnalyzeTime(from); err != nil {
+		return fmt.Errorf(msg("err.analyze_time"), "--from", from)
+	}
+	if o.To, err = parseAnalyzeTime(to); err != nil {
+		return fmt.Errorf(msg("err.analyze_time"), "--to", to)
+	}
+	if !o.From.IsZero() && !o.To.IsZero() && o.To.Before(o.From) {
+		return errors.New(msg("err.analyze_range"))
+	}
+	if o.Bucket <= 0 {
+		return errors.New(msg("err.analyze_bucket"))
+	}
+	switch o.Format {
+	case formatText, formatJSON:
+	default:
+		return fmt.Errorf(msg("err.format"), o.Format)
+	}
+	return nil
+}
+
+// parseAnalyzeTime accepts RFC 3339 or a local "yyyy-mm-dd[ hh:mm[:ss]]".
+func parseAnalyzeTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New(s)
+}
+
+// filter keeps the records inside [From, To) for the selected hosts and
+// IPs, sorted by time so that jitter follows the order of the probes.
+func (o *analyzeOptions) filter(recs []csvRecord) []csvRecord {
+	out := recs[:0]
+	for _, rec := range recs {
+		switch {
+		case !o.From.IsZero() && rec.Time.Before(o.From):
+		case !o.To.IsZero() && !rec.Time.Before(o.To):
+		case len(o.Hosts) > 0 && !containsFold(o.Hosts, rec.Host):
+		case len(o.IPs) > 0 && !containsFold(o.IPs, rec.IP):
+		default:
+			out = append(out, rec)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Time.Before(out[j].Time) })
+	return out
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// =====================
+// CSV log reader
+// =====================
+
+// readCSVLogs reads each file in turn; rotated .csv.gz files are accepted.
+func readCSVLogs(paths []string) ([]csvRecord, error) {
+	var all []csvRecord
+	for _, path := range paths {
+		recs, err := readCSVLog(path)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, recs...)
+	}
+	return all, nil
+}
+
+// readCSVLog looks columns up by header name, so files written with or
+// without the TLS, HTTP and error_class columns can be mixed.
+func readCSVLog(path string) ([]csvRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var in io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		defer zr.Close()
+		in = zr
+	}
+
+	cr := csv.NewReader(in)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	col := make(map[string]int, len(header))
+	for i, name := range header {
+		col[strings.TrimSpace(name)] = i
+	}
+	for _, name := range []string{"timestamp", "host", "ip", "port", "elapsed_ms", "success"} {
+		if _, ok := col[name]; !ok {
+			return nil, fmt.Errorf(msg("err.analyze_column"), path, name)
+		}
+	}
+	get := func(row []string, name string) string {
+		if i, ok := col[name]; ok && i < len(row) {
+			return row[i]
+		}
+		return ""
+	}
+
+	var recs []csvRecord
+	for line := 2; ; line++ {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return recs, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		ts, err := time.Parse(time.RFC3339Nano, get(row, "timestamp"))
+		if err != nil {
+			return nil, fmt.Errorf(msg("err.analyze_row"), path, line, "timestamp")
+		}
+		ms, err := strconv.ParseFloat(get(row, "elapsed_ms"), 64)
+		if err != nil {
+			return nil, fmt.Errorf(msg("err.analyze_row"), path, line, "elapsed_ms")
+		}
+		rec := csvRecord{
+			// The log is in UTC; text output shows local time so that a
+			// bucket label can be pasted back into --from/--to.
+			Time: ts.Local(),
+			Host: get(row, "host"),
+			IP:   get(row, "ip"),
+			Port: get(row, "port"),
+			RTT:  time.Duration(ms * float64(time.Millisecond)),
+
+			SYNRetransmit: get(row, "syn_retransmit") == "true",
+		}
+		if get(row, "success") != "true" {
+			text := get(row, "error")
+			class := get(row, "error_class")
+			if class == "" {
+				class = classifyErrorText(text)
+			}
+			rec.Err = &tcping.RecordedError{Class: class, Text: text}
+		}
+		recs = append(recs, rec)
+	}
+}
+
+// classifyErrorText recovers the class of errors logged before the
+// error_class column existed, from the Go error text.
+func classifyErrorText(text string) string {
+	text = strings.ToLower(text)
+	for _, m := range []struct{ substr, class string }{
+		{"timeout", tcping.ErrClassTimeout},
+		{"connection refused", tcping.ErrClassRefused},
+		{"no route to host", tcping.ErrClassHostUnreachable},
+		{"network is unreachable", tcping.ErrClassNetUnreachable},
+		{"connection reset", tcping.ErrClassReset},
+		{"no such host", tcping.ErrClassDNS},
+		{"permission denied", tcping.ErrClassPermission},
+	} {
+		if strings.Contains(text, m.substr) {
+			return m.class
+		}
+	}
+	return tcping.ErrClassOther
+}
+
+// =====================
+// analyze output
+// =====================
+
+// addTo replays the record into s. Recovered probes keep their RTT: the log
+// does not say whether the run excluded them.
+func (rec csvRecord) addTo(s *tcping.Statistics) {
+	if rec.Err == nil && rec.SYNRetransmit {
+		s.UpdateRecovered(rec.RTT, true)
+		return
+	}
+	s.Update(rec.RTT, rec.Err)
+}
+
+func buildAnalyzeTargets(recs []csvRecord, bucket time.Duration) []*analyzeTarget {
+	byKey := make(map[string]*analyzeTarget)
+	var targets []*analyzeTarget
+	for _, rec := range recs {
+		key := rec.Host + "\x00" + rec.Port
+		t := byKey[key]
+		if t == nil {
+			t = &analyzeTarget{
+				host:    rec.Host,
+				port:    rec.Port,
+				perIP:   make(map[string]*tcping.Statistics),
+				buckets: make(map[time.Time]*tcping.Statistics),
+			}
+			byKey[key] = t
+			targets = append(targets, t)
+		}
+		rec.addTo(&t.stats)
+		rec.addTo(statsFor(t.perIP, rec.IP))
+		rec.addTo(statsFor(t.buckets, truncateLocal(rec.Time, bucket)))
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		if targets[i].host != targets[j].host {
+			return targets[i].host < targets[j].host
+		}
+		return targets[i].port < targets[j].port
+	})
+	return targets
+}
+
+func statsFor[K comparable](m map[K]*tcping.Statistics, k K) *tcping.Statistics {
+	s := m[k]
+	if s == nil {
+		s = &tcping.Statistics{}
+		m[k] = s
+	}
+	return s
+}
+
+func (t *analyzeTarget) print(opts analyzeOptions) {
+	printSummary(t.stats.Snapshot(), opts.Verbose, t.host, t.port)
+
+	if len(t.perIP) > 1 {
+		fmt.Println(msg("summary.per_ip"))
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "IP\tSENT\tRECV\tLOSS\tMIN\tAVG\tP95\tMAX\tSTDDEV\tJITTER")
+		for _, ip := range sortedKeys(t.perIP) {
+			fmt.Fprintln(tw, strings.Join(append([]string{ip}, statsCells(t.perIP[ip].Snapshot())...), "\t"))
+		}
+		_ = tw.Flush()
+	}
+
+	fmt.Printf(msg("analyze.buckets"), opts.Bucket)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tSENT\tRECV\tLOSS\tMIN\tAVG\tP95\tMAX\tSTDDEV\tJITTER")
+	for _, start := range t.bucketTimes() {
+		fmt.Fprintln(tw, strings.Join(append([]string{formatDisplayTimestamp(start)}, statsCells(t.buckets[start].Snapshot())...), "\t"))
+	}
+	_ = tw.Flush()
+}
+
+func (t *analyzeTarget) bucketTimes() []time.Time {
+	times := make([]time.Time, 0, len(t.buckets))
+	for start := range t.buckets {
+		times = append(times, start)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	return times
+}
+
+// bucketRecord is one NDJSON line per time bucket in analyze --format json.
+type bucketRecord struct {
+	summaryRecord
+	Start string `json:"start"`
+}
+
+func writeAnalyzeJSON(targets []*analyzeTarget) {
+	for _, t := range targets {
+		ip := "" // only set when the target used a single address
+		if len(t.perIP) == 1 {
+			ip = sortedKeys(t.perIP)[0]
+		}
+		for _, start := range t.bucketTimes() {
+			rec := bucketRecord{summaryRecord: statsRecord(t.host, ip, t.port, t.buckets[start].Snapshot()), Start: start.UTC().Format(time.RFC3339)}
+			rec.Type = "bucket"
+			writeJSONLine(os.Stdout, rec)
+		}
+		rec := statsRecord(t.host, ip, t.port, t.stats.Snapshot())
+		for _, ip := range sortedKeys(t.perIP) {
+			ps := t.perIP[ip].Snapshot()
+			ir := ipSummaryRecord{IP: ip, Sent: ps.Sent, Received: ps.Received,
+				AvgMS: durMS(ps.Avg), P95MS: durMS(ps.P95), MaxMS: durMS(ps.Max)}
+			if ps.Sent > 0 {
+				ir.LossPct = float64(ps.Sent-ps.Received) / float64(ps.Sent) * 100
+			}
+			rec.PerIP = append(rec.PerIP, ir)
+		}
+		writeJSONLine(os.Stdout, rec)
+	}
+}
+
+const analyzeHelpZH = `%s %s - 离线分析 CSV 记录
+
+用法:
+    tcping analyze [选项] <文件.csv>...
+
+描述:
+    读取 -o 生成的 CSV 文件 (包括轮转后的 .csv.gz), 按目标重新计算统计汇总,
+    并按时间段输出丢失率与延迟表。列按表头名称识别, 新旧版本的文件可以混合使用。
+
+选项:
+        --from <时间>           只统计该时间之后的记录 (RFC3339 或本地时间 "2026-03-19 06:00")
+        --to <时间>             只统计该时间之前的记录
+        --host <主机,...>       只统计指定主机
+        --ip <地址,...>         只统计指定 IP
+        --bucket <时长>         时间段长度 (默认: 1m), 时间段按本地时间显示
+        --format <text|json>    输出格式 (默认: text)
+    -v, --verbose               额外显示平均抖动
+        --lang <zh|en>          输出语言
+    -h, --help                  显示帮助信息
+
+示例:
+    tcping analyze tcping_results_example.com_20260319-060000.csv
+    tcping analyze --bucket 5m --from "2026-03-19 08:00" --to "2026-03-19 09:00" *.csv *.csv.gz
+    tcping analyze --host example.com --ip 93.184.216.34 --format json multi.csv
+`
+
+const analyzeHelpEN = `%s %s - offline analysis of CSV logs
+
+Usage:
+    tcping analyze [options] <file.csv>...
+
+Description:
+    Reads CSV files written by -o (including rotated .csv.gz files), rebuilds
+    the statistics summary per target and prints loss and latency per time
+    bucket. Columns are found by header name, so files from older and newer
+    versions can be mixed.
+
+Options:
+        --from <time>           Only records at or after this time (RFC3339 or local "2026-03-19 06:00")
+        --to <time>             Only records before this time
+        --host <host,...>       Only these hosts
+        --ip <addr,...>         Only these IPs
+        --bucket <duration>     Time bucket length (default: 1m); buckets are shown in local time
+        --format <text|json>    Output format (default: text)
+    -v, --verbose               Also show the average jitter
+        --lang <zh|en>          Output language
+    -h, --help                  Show this help message
+
+Examples:
+    tcping analyze tcping_results_example.com_20260319-060000.csv
+    tcping analyze --bucket 5m --from "2026-03-19 08:00" --to "2026-03-19 09:00" *.csv *.csv.gz
+    tcping analyze --host example.com --ip 93.184.216.34 --format json multi.csv
+`
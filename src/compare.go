@@ -0,0 +1,539 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nodeseeker/tcping"
+)
+
+// =====================
+// compare subcommand
+// =====================
+
+const defaultCompareAlpha = 0.05
+
+type compareOptions struct {
+	FailLoss float64       // loss increase in percentage points, <0 = off
+	FailAvg  time.Duration // average RTT increase, 0 = off
+	FailP95  time.Duration // P95 RTT increase, 0 = off
+	Test     bool          // require statistical significance for a regression
+	Alpha    float64
+	Format   string
+}
+
+// compareSide holds one run of one comparePair.
+type compareSide struct {
+	stats tcping.Statistics
+	rtts  []float64 // successful RTTs in ms, for the rank test
+}
+
+type compareKey struct{ host, ip, port string }
+
+func (k compareKey) String() string {
+	return fmt.Sprintf("%s [%s]:%s", k.host, k.ip, k.port)
+}
+
+// comparePair is one host/ip/port found in both runs, or one host:port
+// whose addresses changed between the runs, with the records of each side.
+type comparePair struct {
+	key               compareKey
+	beforeIP, afterIP string
+	before, after     []csvRecord
+}
+
+// compareResult is one aligned host/ip/port with its verdict.
+type compareResult struct {
+	key               compareKey
+	beforeIP, afterIP string
+	before, after     tcping.StatsSnapshot
+	rttP, lossP       float64 // two-sided p-values, NaN when not tested
+	reasons           []string
+}
+
+// runCompare implements `tcping compare` and returns the exit code.
+func runCompare(args []string) int {
+	fs := flag.NewFlagSet("compare", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var (
+		opts      compareOptions
+		failAvgMS float64
+		failP95MS float64
+		langFlag  string
+		showHelp  bool
+	)
+	fs.Float64Var(&opts.FailLoss, "fail-loss", -1, "")
+	fs.Float64Var(&failAvgMS, "fail-avg", 0, "")
+	fs.Float64Var(&failP95MS, "fail-p95", 0, "")
+	fs.BoolVar(&opts.Test, "test", false, "")
+	fs.Float64Var(&opts.Alpha, "alpha", defaultCompareAlpha, "")
+	fs.StringVar(&opts.Format, "format", formatText, "")
+	fs.StringVar(&langFlag, "lang", "", "")
+	fs.BoolVar(&showHelp, "h", false, "")
+	fs.BoolVar(&showHelp, "help", false, "")
+
+	if err := fs.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, msg("err.generic"), err)
+		return exitUsage
+	}
+	if langFlag != "" {
+		l, err := detectLang(langFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, msg("err.generic"), err)
+			return exitUsage
+		}
+		lang = l
+	}
+	if showHelp {
+		fmt.Printf(msg("compare.help"), programName, version)
+		return exitOK
+	}
+	opts.FailAvg = time.Duration(failAvgMS * float64(time.Millisecond))
+	opts.FailP95 = time.Duration(failP95MS * float64(time.Millisecond))
+
+	if err := opts.validate(); err != nil {
+		fmt.Fprintf(os.Stderr, msg("err.generic"), err)
+		return exitUsage
+	}
+	if fs.NArg() != 2 {
+		fmt.Fprintf(os.Stderr, msg("err.generic"), msg("err.compare_files"))
+		return exitUsage
+	}
+
+	before, err := loadCompareSide(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, msg("err.generic"), err)
+		return exitError
+	}
+	after, err := loadCompareSide(fs.Arg(1))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, msg("err.generic"), err)
+		return exitError
+	}
+
+	pairs, onlyBefore, onlyAfter := pairCompareKeys(before, after)
+	for _, k := range onlyBefore {
+		fmt.Fprintf(os.Stderr, msg("compare.only"), fs.Arg(0), k)
+	}
+	for _, k := range onlyAfter {
+		fmt.Fprintf(os.Stderr, msg("compare.only"), fs.Arg(1), k)
+	}
+	var results []compareResult
+	for _, p := range pairs {
+		results = append(results, opts.compare(p))
+	}
+	if len(results) == 0 {
+		fmt.Fprintf(os.Stderr, msg("err.generic"), msg("err.compare_none"))
+		return exitError
+	}
+
+	code := exitOK
+	for _, res := range results {
+		if opts.Format == formatJSON {
+			writeJSONLine(os.Stdout, res.record())
+		} else {
+			res.print()
+		}
+		if len(res.reasons) > 0 {
+			code = exitDegraded
+		}
+	}
+	for _, res := range results {
+		for _, reason := range res.reasons {
+			fmt.Fprintf(os.Stderr, msg("compare.regression"), res.key, reason)
+		}
+	}
+	return code
+}
+
+func (o *compareOptions) validate() error {
+	if o.FailAvg < 0 || o.FailP95 < 0 {
+		return errors.New(msg("err.fail_rtt"))
+	}
+	if o.Alpha <= 0 || o.Alpha >= 1 {
+		return errors.New(msg("err.compare_alpha"))
+	}
+	switch o.Format {
+	case formatText, formatJSON:
+	default:
+		return fmt.Errorf(msg("err.format"), o.Format)
+	}
+	return nil
+}
+
+// loadCompareSide reads one run and splits it per host/ip/port, in time
+// order so that jitter matches the live summary.
+func loadCompareSide(path string) (map[compareKey][]csvRecord, error) {
+	recs, err := readCSVLog(path)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(recs, func(i, j int) bool { return recs[i].Time.Before(recs[j].Time) })
+
+	sides := make(map[compareKey][]csvRecord)
+	for _, rec := range recs {
+		k := compareKey{rec.Host, rec.IP, rec.Port}
+		sides[k] = append(sides[k], rec)
+	}
+	return sides, nil
+}
+
+// pairCompareKeys aligns the two runs by host/ip/port. Keys left over on
+// both sides are then aligned by host and port, so that a target whose DNS
+// answer changed between the runs is still compared, over all of its
+// addresses. onlyBefore and onlyAfter are the keys that match nothing.
+func pairCompareKeys(before, after map[compareKey][]csvRecord) (pairs []comparePair, onlyBefore, onlyAfter []compareKey) {
+	type hostPort struct{ host, port string }
+	restBefore := make(map[hostPort][]compareKey)
+	restAfter := make(map[hostPort][]compareKey)
+
+	for _, k := range sortedCompareKeys(before) {
+		if a, ok := after[k]; ok {
+			pairs = append(pairs, comparePair{key: k, beforeIP: k.ip, afterIP: k.ip, before: before[k], after: a})
+			continue
+		}
+		hp := hostPort{k.host, k.port}
+		restBefore[hp] = append(restBefore[hp], k)
+	}
+	for _, k := range sortedCompareKeys(after) {
+		if _, ok := before[k]; ok {
+			continue
+		}
+		hp := hostPort{k.host, k.port}
+		restAfter[hp] = append(restAfter[hp], k)
+	}
+
+	for hp, bk := range restBefore {
+		ak := restAfter[hp]
+		if len(ak) == 0 {
+			onlyBefore = append(onlyBefore, bk...)
+			continue
+		}
+		p := comparePair{
+			beforeIP: joinKeyIPs(bk),
+			afterIP:  joinKeyIPs(ak),
+			before:   mergeRecords(before, bk),
+			after:    mergeRecords(after, ak),
+		}
+		p.key = compareKey{hp.host, p.beforeIP + " -> " + p.afterIP, hp.port}
+		pairs = append(pairs, p)
+	}
+	for hp, ak := range restAfter {
+		if len(restBefore[hp]) == 0 {
+			onlyAfter = append(onlyAfter, ak...)
+		}
+	}
+
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].key.String() < pairs[j].key.String() })
+	byName := func(keys []compareKey) func(i, j int) bool {
+		return func(i, j int) bool { return keys[i].String() < keys[j].String() }
+	}
+	sort.Slice(onlyBefore, byName(onlyBefore))
+	sort.Slice(onlyAfter, byName(onlyAfter))
+	return pairs, onlyBefore, onlyAfter
+}
+
+func joinKeyIPs(keys []compareKey) string {
+	ips := make([]string, len(keys))
+	for i, k := range keys {
+		ips[i] = k.ip
+	}
+	return strings.Join(ips, ",")
+}
+
+// mergeRecords combines the records of several keys back into time order.
+func mergeRecords(m map[compareKey][]csvRecord, keys []compareKey) []csvRecord {
+	var recs []csvRecord
+	for _, k := range keys {
+		recs = append(recs, m[k]...)
+	}
+	sort.SliceStable(recs, func(i, j int) bool { return recs[i].Time.Before(recs[j].Time) })
+	return recs
+}
+
+func newCompareSide(recs []csvRecord) *compareSide {
+	side := &compareSide{}
+	for _, rec := range recs {
+		rec.addTo(&side.stats)
+		if rec.Err == nil {
+			side.rtts = append(side.rtts, durMS(rec.RTT))
+		}
+	}
+	return side
+}
+
+func sortedCompareKeys(m map[compareKey][]csvRecord) []compareKey {
+	keys := make([]compareKey, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+	return keys
+}
+
+// compare computes the deltas of one pair and the thresholds they cross.
+// With --test a crossing only counts when the change is significant.
+func (o *compareOptions) compare(p comparePair) compareResult {
+	before, after := newCompareSide(p.before), newCompareSide(p.after)
+	res := compareResult{
+		key:      p.key,
+		beforeIP: p.beforeIP,
+		afterIP:  p.afterIP,
+		before:   before.stats.Snapshot(),
+		after:    after.stats.Snapshot(),
+		rttP:     math.NaN(),
+		lossP:    math.NaN(),
+	}
+	if o.Test {
+		res.rttP = mannWhitneyP(before.rtts, after.rtts)
+		res.lossP = twoProportionP(res.before.Sent-res.before.Received, res.before.Sent,
+			res.after.Sent-res.after.Received, res.after.Sent)
+	}
+	significant := func(p float64) bool { return !o.Test || p < o.Alpha }
+
+	if d := lossPct(res.after) - lossPct(res.before); o.FailLoss >= 0 && d > o.FailLoss && significant(res.lossP) {
+		res.reasons = append(res.reasons, fmt.Sprintf(msg("compare.loss"), d, o.FailLoss))
+	}
+	if res.before.Received == 0 || res.after.Received == 0 {
+		return res
+	}
+	if d := res.after.Avg - res.before.Avg; o.FailAvg > 0 && d > o.FailAvg && significant(res.rttP) {
+		res.reasons = append(res.reasons, fmt.Sprintf(msg("compare.avg"), durMS(d), durMS(o.FailAvg)))
+	}
+	if d := res.after.P95 - res.before.P95; o.FailP95 > 0 && d > o.FailP95 && significant(res.rttP) {
+		res.reasons = append(res.reasons, fmt.Sprintf(msg("compare.p95"), durMS(d), durMS(o.FailP95)))
+	}
+	return res
+}
+
+func lossPct(s tcping.StatsSnapshot) float64 {
+	if s.Sent == 0 {
+		return 0
+	}
+	return float64(s.Sent-s.Received) / float64(s.Sent) * 100
+}
+
+func (res compareResult) print() {
+	fmt.Printf(msg("compare.title"), res.key.host, res.key.ip, res.key.port, res.before.Sent, res.after.Sent)
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "METRIC\tBEFORE\tAFTER\tDELTA")
+	lb, la := lossPct(res.before), lossPct(res.after)
+	fmt.Fprintf(tw, "LOSS\t%.1f%%\t%.1f%%\t%+.1f%%\n", lb, la, la-lb)
+	if res.before.Recovered > 0 || res.after.Recovered > 0 {
+		fmt.Fprintf(tw, "RECOVERED\t%d\t%d\t%+d\n", res.before.Recovered, res.after.Recovered, res.after.Recovered-res.before.Recovered)
+	}
+	for _, m := range []struct {
+		name          string
+		before, after time.Duration
+	}{
+		{"AVG", res.before.Avg, res.after.Avg},
+		{"P50", res.before.P50, res.after.P50},
+		{"P95", res.before.P95, res.after.P95},
+		{"P99", res.before.P99, res.after.P99},
+		{"JITTER", res.before.JitterAvg, res.after.JitterAvg},
+	} {
+		if res.before.Received == 0 || res.after.Received == 0 {
+			fmt.Fprintf(tw, "%s\t-\t-\t-\n", m.name)
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%.2fms\t%.2fms\t%s\n", m.name, durMS(m.before), durMS(m.after), formatDelta(m.before, m.after))
+	}
+	_ = tw.Flush()
+
+	if !math.IsNaN(res.rttP) {
+		fmt.Printf(msg("compare.test"), formatPValue(res.rttP), formatPValue(res.lossP))
+	}
+}
+
+// formatDelta shows an absolute and a relative change, e.g. +6.93ms (+16.9%).
+func formatDelta(before, after time.Duration) string {
+	d := durMS(after - before)
+	if before == 0 {
+		return fmt.Sprintf("%+.2fms", d)
+	}
+	return fmt.Sprintf("%+.2fms (%+.1f%%)", d, d/durMS(before)*100)
+}
+
+func formatPValue(p float64) string {
+	if math.IsNaN(p) {
+		return "-"
+	}
+	if p < 0.0001 {
+		return "<0.0001"
+	}
+	return fmt.Sprintf("%.4f", p)
+}
+
+// compareRecord is one NDJSON line per aligned host/ip/port in
+// compare --format json.
+type compareRecord struct {
+	Type       string        `json:"type"`
+	Host       string        `json:"host"`
+	IP         string        `json:"ip"`
+	Port       int           `json:"port"`
+	Before     summaryRecord `json:"before"`
+	After      summaryRecord `json:"after"`
+	RTTPValue  *float64      `json:"rtt_p_value,omitempty"`
+	LossPValue *float64      `json:"loss_p_value,omitempty"`
+	Regression bool          `json:"regression"`
+	Reasons    []string      `json:"reasons,omitempty"`
+}
+
+func (res compareResult) record() compareRecord {
+	rec := compareRecord{
+		Type:       "compare",
+		Before:     statsRecord(res.key.host, res.beforeIP, res.key.port, res.before),
+		After:      statsRecord(res.key.host, res.afterIP, res.key.port, res.after),
+		Regression: len(res.reasons) > 0,
+		Reasons:    res.reasons,
+	}
+	rec.Host, rec.IP, rec.Port = rec.Before.Host, res.key.ip, rec.Before.Port
+	if !math.IsNaN(res.rttP) {
+		rec.RTTPValue = &res.rttP
+	}
+	if !math.IsNaN(res.lossP) {
+		rec.LossPValue = &res.lossP
+	}
+	return rec
+}
+
+// =====================
+// Significance tests
+// =====================
+
+// mannWhitneyP is the two-sided p-value of the Mann-Whitney U test, using
+// the normal approximation with tie correction. RTT distributions are
+// skewed, so a rank test is used instead of a t-test. It returns NaN when
+// either sample is empty.
+func mannWhitneyP(a, b []float64) float64 {
+	n1, n2 := float64(len(a)), float64(len(b))
+	if n1 == 0 || n2 == 0 {
+		return math.NaN()
+	}
+
+	type obs struct {
+		v     float64
+		first bool
+	}
+	all := make([]obs, 0, len(a)+len(b))
+	for _, v := range a {
+		all = append(all, obs{v, true})
+	}
+	for _, v := range b {
+		all = append(all, obs{v, false})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].v < all[j].v })
+
+	var r1, ties float64
+	for i := 0; i < len(all); {
+		j := i
+		for j < len(all) && all[j].v == all[i].v {
+			j++
+		}
+		rank := float64(i+j+1) / 2 // average of ranks i+1..j
+		for k := i; k < j; k++ {
+			if all[k].first {
+				r1 += rank
+			}
+		}
+		t := float64(j - i)
+		ties += t*t*t - t
+		i = j
+	}
+
+	n := n1 + n2
+	u := r1 - n1*(n1+1)/2
+	mu := n1 * n2 / 2
+	sigma := math.Sqrt(n1 * n2 / 12 * ((n + 1) - ties/(n*(n-1))))
+	if sigma == 0 {
+		return 1
+	}
+	z := (math.Abs(u-mu) - 0.5) / sigma // continuity correction
+	if z < 0 {
+		z = 0
+	}
+	return math.Erfc(z / math.Sqrt2)
+}
+
+// twoProportionP is the two-sided p-value of the pooled two-proportion z
+// test on lost/sent. It returns NaN when either side sent nothing.
+func twoProportionP(lost1, sent1, lost2, sent2 int64) float64 {
+	if sent1 == 0 || sent2 == 0 {
+		return math.NaN()
+	}
+	n1, n2 := float64(sent1), float64(sent2)
+	p1, p2 := float64(lost1)/n1, float64(lost2)/n2
+	p := float64(lost1+lost2) / (n1 + n2)
+	se := math.Sqrt(p * (1 - p) * (1/n1 + 1/n2))
+	if se == 0 {
+		return 1
+	}
+	return math.Erfc(math.Abs(p2-p1) / se / math.Sqrt2)
+}
+
+const compareHelpZH = `%s %s - 比较两次运行的 CSV 记录
+
+用法:
+    tcping compare [选项] <之前.csv> <之后.csv>
+
+描述:
+    按 主机/IP/端口 对齐两份 -o 生成的 CSV 记录, 列出丢失率、平均值、分位数和抖动的变化。
+    设置 --fail-* 阈值后, 任一目标的退化超过阈值时以退出码 4 结束; 加上 --test 时
+    只有统计上显著 (p < --alpha) 的退化才计入。
+
+选项:
+        --fail-loss <百分点>    丢失率增加超过该值视为退化
+        --fail-avg <毫秒>       平均 RTT 增加超过该值视为退化
+        --fail-p95 <毫秒>       P95 RTT 增加超过该值视为退化
+        --test                  进行显著性检验 (RTT: Mann-Whitney U, 丢失率: 双比例 z 检验)
+        --alpha <p>             显著性水平 (默认: 0.05)
+        --format <text|json>    输出格式 (默认: text)
+        --lang <zh|en>          输出语言
+    -h, --help                  显示帮助信息
+
+退出码:
+    0 无退化, 1 读取错误或没有共同目标, 2 参数错误, 4 存在超过阈值的退化
+
+示例:
+    tcping compare before.csv after.csv
+    tcping compare --test --fail-avg 5 --fail-loss 1 before.csv after.csv
+`
+
+const compareHelpEN = `%s %s - compare the CSV logs of two runs
+
+Usage:
+    tcping compare [options] <before.csv> <after.csv>
+
+Description:
+    Aligns two CSV logs written by -o per host/IP/port and reports the change
+    in loss, mean, percentiles and jitter. With --fail-* thresholds the exit
+    code is 4 when any target regressed beyond them; with --test only
+    statistically significant (p < --alpha) regressions count.
+
+Options:
+        --fail-loss <points>    Regression when loss grows by more than this many percentage points
+        --fail-avg <ms>         Regression when the average RTT grows by more than this
+        --fail-p95 <ms>         Regression when the P95 RTT grows by more than this
+        --test                  Run significance tests (RTT: Mann-Whitney U, loss: two-proportion z test)
+        --alpha <p>             Significance level (default: 0.05)
+        --format <text|json>    Output format (default: text)
+        --lang <zh|en>          Output language
+    -h, --help                  Show this help message
+
+Exit codes:
+    0 no regression, 1 read error or no common target, 2 usage error, 4 regression beyond a threshold
+
+Examples:
+    tcping compare before.csv after.csv
+    tcping compare --test --fail-avg 5 --fail-loss 1 before.csv after.csv
+`
@@ -1,19 +1,32 @@
 package main
 
 import (
+	"bufio"
+	"compress/gzip"
 	"context"
 	"encoding/csv"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"math"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
+	"text/tabwriter"
 	"time"
+
+	"github.com/nodeseeker/tcping"
 )
 
 const (
@@ -25,421 +38,1036 @@ const (
 	defaultCSVFlushTick  = 1 * time.Second
 
 	defaultPort = 80
+
+	// Exit codes; see printHelp and README.
+	exitOK          = 0
+	exitError       = 1 // runtime error, e.g. DNS resolution failed
+	exitUsage       = 2 // invalid flags or arguments (same as package flag)
+	exitUnreachable = 3 // a target never responded
+	exitDegraded    = 4 // a --fail-*/--require-success threshold was crossed
+
+	formatText = "text"
+	formatJSON = "json"
+
+	csvModeBestEffort = "best-effort" // drop rows when the writer falls behind
+	csvModeLossless   = "lossless"    // block probes until the row is queued
 )
 
 // =====================
 // Options
 // =====================
 
+// Options is the probe configuration plus everything that only concerns
+// the command line: output, CSV, metrics and exit thresholds.
 type Options struct {
-	UseIPv4       bool
-	UseIPv6       bool
-	Count         int           // 0 = infinite
-	Interval      time.Duration // ping interval
-	Timeout       time.Duration // dial timeout
-	DNSTimeout    time.Duration // dns lookup timeout
-	DNSServer     string        // optional DNS server, supports ip or ip:port
+	tcping.Config
+
 	ColorOutput   bool
 	VerboseMode   bool
 	ShowTimestamp bool
 	ShowVersion   bool
 	ShowHelp      bool
-	Port          int // default is set by flags (80). Must be 1..65535.
+	Port          int           // default is set by flags (80). Must be 1..65535.
+	Format        string        // "text" or "json" (NDJSON on stdout)
+	Duration      time.Duration // stop after this long, 0 = off
+	Deadline      string        // stop at this RFC 3339 time, empty = off
+	JSONFile      string        // optional NDJSON copy of the output, appended
+	TUI           bool          // live dashboard instead of scrolling lines, text format on a terminal only
+	Lang          string        // "zh" or "en", empty = from LC_ALL/LC_MESSAGES/LANG
+
+	TargetsFile string // optional file with one target per line
+
+	TOSFlag int    // --tos, -1 = unset; folded into Config.TOS
+	DSCP    int    // --dscp, -1 = unset; Config.TOS = DSCP << 2
+	FWMark  uint64 // --fwmark, checked to fit Config.Mark
+
+	MetricsListen string // optional address serving Prometheus /metrics
+
+	FailLoss       float64       // loss percent above which the run is degraded, NaN = off
+	FailAvg        time.Duration // average RTT above which the run is degraded, 0 = off
+	FailP95        time.Duration // P95 RTT above which the run is degraded, 0 = off
+	RequireSuccess int64         // minimum successful probes, 0 = off
+
+	HTTPHeaders []string // raw -H values, parsed into Config.HTTPHeader
+	HTTPStatus  string   // expected status codes, e.g. "200-399"
 
 	CSVAuto       bool
 	CSVPath       string
+	CSVMode       string        // csvModeBestEffort or csvModeLossless
 	CSVFlushEvery int           // flush every N rows
 	CSVFlushTick  time.Duration // also flush on tick
+
+	CSVRotateSize  string        // e.g. "100M", parsed by parseByteSize; empty = off
+	CSVRotateEvery time.Duration // 0 = off
+	CSVKeep        int           // rotated files to keep, 0 = all
+	CSVGzip        bool
 }
 
 // =====================
-// Statistics (Duration-based)
+// Reporters
 // =====================
 
-type Statistics struct {
-	mu sync.Mutex
+// Reporter is an output sink for probe events. Several reporters can be
+// active at once; OnStart and OnResult may be called concurrently.
+type Reporter interface {
+	OnStart(r *tcping.Runner)
+	OnResult(r *tcping.Runner, res tcping.Result)
+	OnSummary(runners []*tcping.Runner)
+}
 
-	sentCount      int64
-	respondedCount int64
+// resolveReporter is implemented by reporters that also show
+// re-resolution events.
+type resolveReporter interface {
+	OnResolve(r *tcping.Runner, ev tcping.ResolveEvent)
+}
 
-	minRTT time.Duration
-	maxRTT time.Duration
-	sumRTT time.Duration
+// reporters fans every event out to each sink in order.
+type reporters []Reporter
 
-	lastRTT     time.Duration
-	sumJitter   time.Duration
-	jitterCount int64
+func (rs reporters) OnStart(r *tcping.Runner) {
+	for _, rep := range rs {
+		rep.OnStart(r)
+	}
+}
 
-	initialized bool
+func (rs reporters) OnResult(r *tcping.Runner, res tcping.Result) {
+	for _, rep := range rs {
+		rep.OnResult(r, res)
+	}
 }
 
-func (s *Statistics) Update(rtt time.Duration, success bool) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+func (rs reporters) OnResolve(r *tcping.Runner, ev tcping.ResolveEvent) {
+	for _, rep := range rs {
+		if rr, ok := rep.(resolveReporter); ok {
+			rr.OnResolve(r, ev)
+		}
+	}
+}
 
-	s.sentCount++
-	if !success {
-		return
+func (rs reporters) OnSummary(runners []*tcping.Runner) {
+	for _, rep := range rs {
+		rep.OnSummary(runners)
 	}
-	s.respondedCount++
-	s.sumRTT += rtt
+}
 
-	if !s.initialized {
-		s.minRTT = rtt
-		s.maxRTT = rtt
-		s.lastRTT = rtt
-		s.initialized = true
-		return
+// Close releases sinks that hold files, once every runner has stopped.
+func (rs reporters) Close() {
+	for _, rep := range rs {
+		if c, ok := rep.(io.Closer); ok {
+			_ = c.Close()
+		}
 	}
+}
 
-	j := rtt - s.lastRTT
-	if j < 0 {
-		j = -j
+// newReporters builds the sinks selected on the command line: stdout in
+// the chosen --format, plus the optional --json-file and -o/--csv files.
+// Files are opened here so that a bad path fails before any probe is sent.
+func newReporters(opts *Options, targets []tcping.Target) (reporters, error) {
+	multi := len(targets) > 1
+
+	var rs reporters
+	switch {
+	case opts.Format == formatJSON:
+		rs = append(rs, &jsonReporter{opts: opts, w: os.Stdout})
+	case opts.TUI && isTerminal(os.Stdout):
+		rs = append(rs, newTUIReporter(opts, &textReporter{opts: opts, multi: multi}))
+	default:
+		rs = append(rs, &textReporter{opts: opts, multi: multi})
 	}
-	s.sumJitter += j
-	s.jitterCount++
-	s.lastRTT = rtt
 
-	if rtt < s.minRTT {
-		s.minRTT = rtt
+	if opts.JSONFile != "" {
+		f, err := os.OpenFile(opts.JSONFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf(msg("err.json_file"), opts.JSONFile, err)
+		}
+		rs = append(rs, &jsonReporter{opts: opts, w: f, closer: f})
 	}
-	if rtt > s.maxRTT {
-		s.maxRTT = rtt
+
+	if opts.CSVAuto {
+		if opts.CSVPath == "" {
+			name := sanitizeFilename(targets[0].Host)
+			if multi {
+				name = "multi"
+			}
+			opts.CSVPath = fmt.Sprintf("tcping_results_%s_%s.csv", name, time.Now().Format("20060102-150405"))
+		}
+		f, err := os.OpenFile(opts.CSVPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			rs.Close()
+			return nil, fmt.Errorf(msg("csv.open"), opts.CSVPath, err)
+		}
+		c := &csvReporter{opts: opts, lossless: opts.CSVMode == csvModeLossless}
+		rot := csvRotation{Every: opts.CSVRotateEvery, Keep: opts.CSVKeep, Gzip: opts.CSVGzip}
+		rot.Size, _ = parseByteSize(opts.CSVRotateSize)
+		c.ch = startCSVWriter(f, csvHeader(opts), &c.wg, opts.CSVFlushEvery, opts.CSVFlushTick, rot)
+		rs = append(rs, c)
 	}
+	return rs, nil
 }
 
-func (s *Statistics) SentCount() int64 {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	return s.sentCount
+// tag prefixes lines with the target when several share stdout.
+func tag(r *tcping.Runner, multi bool) string {
+	if !multi {
+		return ""
+	}
+	return "[" + r.Target() + "] "
 }
 
-type StatsSnapshot struct {
-	Sent      int64
-	Received  int64
-	Min       time.Duration
-	Max       time.Duration
-	Avg       time.Duration
-	JitterAvg time.Duration
+// textReporter prints the human-readable output on stdout.
+type textReporter struct {
+	opts  *Options
+	multi bool
 }
 
-func (s *Statistics) Snapshot() StatsSnapshot {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+func (t *textReporter) prefix(r *tcping.Runner, ts time.Time) string {
+	prefix := ""
+	if t.opts.ShowTimestamp {
+		prefix = "[" + formatDisplayTimestamp(ts) + "] "
+	}
+	return prefix + tag(r, t.multi)
+}
 
-	var avg time.Duration
-	if s.respondedCount > 0 {
-		avg = time.Duration(s.sumRTT.Nanoseconds() / s.respondedCount)
+func (t *textReporter) OnStart(r *tcping.Runner) {
+	tag := tag(r, t.multi)
+	if net.ParseIP(r.Host()) == nil {
+		fmt.Printf(msg("intro.with_ip"), tag, r.Host(), r.IPType(), r.IP(), r.Port())
+	} else {
+		fmt.Printf(msg("intro.plain"), tag, r.Host(), r.Port())
 	}
 
-	var jitterAvg time.Duration
-	if s.jitterCount > 0 {
-		jitterAvg = time.Duration(s.sumJitter.Nanoseconds() / s.jitterCount)
+	if t.opts.AllIPs != "" {
+		mode := msg("intro.mode_rr")
+		if t.opts.AllIPs == tcping.AllIPsEach {
+			mode = msg("intro.mode_each")
+		}
+		pool := r.ProbeIPs()
+		fmt.Printf(msg("intro.all_ips"), tag, mode, len(pool), strings.Join(pool, ", "))
+	}
+	if t.opts.Source != "" {
+		fmt.Printf(msg("intro.source"), tag, t.opts.Source)
+	}
+	if t.opts.Interface != "" {
+		fmt.Printf(msg("intro.interface"), tag, t.opts.Interface)
+	}
+	if so := sockoptSummary(&t.opts.Config); so != "" {
+		fmt.Printf(msg("intro.sockopts"), tag, so)
+	}
+	if t.opts.SYN {
+		fmt.Printf(msg("intro.syn"), tag)
 	}
 
-	return StatsSnapshot{
-		Sent:      s.sentCount,
-		Received:  s.respondedCount,
-		Min:       s.minRTT,
-		Max:       s.maxRTT,
-		Avg:       avg,
-		JitterAvg: jitterAvg,
+	if !t.opts.VerboseMode {
+		return
+	}
+	if addrs := r.Addrs(); len(addrs) > 1 {
+		fmt.Printf(msg("intro.resolved"), r.Host())
+		for i, ip := range addrs {
+			if strings.Contains(ip, ":") {
+				fmt.Printf("  [%d] IPv6: %s\n", i+1, ip)
+			} else {
+				fmt.Printf("  [%d] IPv4: %s\n", i+1, ip)
+			}
+		}
+		fmt.Printf(msg("intro.using_ip"), r.IP())
+	}
+	if d := r.DNSTime(); d > 0 {
+		fmt.Printf(msg("intro.dns_time"), tag, durMS(d))
 	}
 }
 
-// =====================
-// Runner
-// =====================
-
-type Runner struct {
-	opts *Options
-
-	host string
-	port string
+// printSYNResult shows the port state of a --syn probe.
+func (t *textReporter) printSYNResult(r *tcping.Runner, res tcping.Result, prefix string) {
+	color := t.opts.ColorOutput
+	switch res.PortState {
+	case tcping.PortOpen:
+		fmt.Print(successText(fmt.Sprintf(msg("probe.syn_open"), prefix, res.IP, r.Port(), res.Seq, durMS(res.RTT)), color))
+		if t.opts.VerboseMode {
+			fmt.Printf(msg("probe.reply_detail"), prefix, res.LocalAddr, net.JoinHostPort(res.IP, r.Port()))
+		}
+	case tcping.PortClosed:
+		fmt.Print(errorText(fmt.Sprintf(msg("probe.syn_closed"), prefix, res.IP, r.Port(), res.Seq, durMS(res.RTT)), color))
+	default:
+		fmt.Print(errorText(fmt.Sprintf(msg("probe.syn_filtered"), prefix, res.IP, r.Port(), res.Seq), color))
+	}
+}
 
-	chosenIP string // display + dial (JoinHostPort will bracket IPv6)
-	ipType   string
-	allIPs   []net.IP
+func (t *textReporter) OnResult(r *tcping.Runner, res tcping.Result) {
+	prefix := t.prefix(r, res.Time)
+	addr := net.JoinHostPort(res.IP, r.Port())
+	color := t.opts.ColorOutput
 
-	stats *Statistics
+	switch {
+	case res.PortState != "":
+		t.printSYNResult(r, res, prefix)
+		return
+	case res.Success():
+		switch {
+		case res.HTTP != nil:
+			fmt.Print(successText(fmt.Sprintf(msg("probe.reply_http"), prefix, res.IP, r.Port(), res.Seq, res.HTTP.Status, formatHTTPTimings(res.RTT, res.TLS, res.HTTP)), color))
+		case res.TLS != nil:
+			fmt.Print(successText(fmt.Sprintf(msg("probe.reply_tls"), prefix, res.IP, r.Port(), res.Seq, durMS(res.RTT), durMS(res.TLS.Handshake)), color))
+		default:
+			fmt.Print(successText(fmt.Sprintf(msg("probe.reply"), prefix, res.IP, r.Port(), res.Seq, durMS(res.RTT)), color))
+		}
+		if res.SYNRetransmit {
+			fmt.Printf(msg("probe.syn_retransmit"), prefix)
+		}
+		if t.opts.VerboseMode {
+			fmt.Printf(msg("probe.reply_detail"), prefix, res.LocalAddr, addr)
+			if ti := res.TCPInfo; ti != nil {
+				fmt.Printf(msg("probe.tcpinfo_detail"),
+					prefix, durMS(ti.SRTT), durMS(ti.RTTVar), ti.Retransmits, ti.SYNRetransmits, ti.MSS, ti.PMTU)
+			}
+			if res.TLS != nil {
+				fmt.Printf(msg("probe.tls_detail"),
+					prefix, res.TLS.Version, res.TLS.Cipher, orDash(res.TLS.ALPN), formatCertExpiry(res.TLS.CertExpiry))
+			}
+		}
+	case tcping.IsTLSError(res.Err):
+		fmt.Print(errorText(fmt.Sprintf(msg("probe.tls_fail"), prefix, res.IP, r.Port(), res.Seq, durMS(res.RTT), errorClassLabel(tcping.ClassifyError(res.Err)), localizeError(res.Err)), color))
+		if t.opts.VerboseMode {
+			fmt.Printf(msg("probe.tls_fail_detail"), prefix, durMS(res.TLS.Handshake), r.ServerName(), addr)
+		}
+	case res.HTTP != nil:
+		fmt.Print(errorText(fmt.Sprintf(msg("probe.http_fail"), prefix, res.IP, r.Port(), res.Seq, formatHTTPTimings(res.RTT, res.TLS, res.HTTP), errorClassLabel(tcping.ClassifyError(res.Err)), localizeError(res.Err)), color))
+	default:
+		fmt.Print(errorText(fmt.Sprintf(msg("probe.tcp_fail"), prefix, res.IP, r.Port(), res.Seq, errorClassLabel(tcping.ClassifyError(res.Err)), localizeError(res.Err)), color))
+		if t.opts.VerboseMode {
+			fmt.Printf(msg("probe.tcp_fail_detail"), prefix, durMS(res.RTT), addr)
+		}
+	}
+}
 
-	csv   chan []string
-	csvWG sync.WaitGroup
+func (t *textReporter) OnResolve(r *tcping.Runner, ev tcping.ResolveEvent) {
+	prefix := t.prefix(r, ev.Time)
+	if ev.Err != nil {
+		fmt.Fprintf(stderr, msg("event.failed"), prefix, resolveReason(ev), localizeError(ev.Err))
+		return
+	}
+	fmt.Printf(msg("event.changed"),
+		prefix, resolveReason(ev), r.Host(), ev.OldIP, ev.NewIP, strings.Join(ev.IPs, ", "))
 }
 
-func NewRunner(opts *Options, host, port string) *Runner {
-	return &Runner{
-		opts:  opts,
-		host:  host,
-		port:  port,
-		stats: &Statistics{},
+func resolveReason(ev tcping.ResolveEvent) string {
+	if ev.Reason == tcping.ReasonFailures {
+		return msg("event.reason_failures")
 	}
+	return msg("event.reason_interval")
 }
 
-func (r *Runner) DisplayHost() string {
-	if net.ParseIP(r.host) == nil && r.chosenIP != "" {
-		return fmt.Sprintf("%s [%s]", r.host, r.chosenIP)
+func (t *textReporter) OnSummary(runners []*tcping.Runner) {
+	if t.multi {
+		fmt.Printf(msg("summary.group"), len(runners))
+		printStatsTable([]string{"TARGET"}, runners)
+		return
+	}
+
+	r := runners[0]
+	printSummary(r.Stats(), t.opts.VerboseMode, displayHost(r), r.Port())
+	if t.opts.AllIPs != "" {
+		fmt.Println(msg("summary.per_ip"))
+		printStatsTable(nil, runners)
+	}
+	if t.opts.TLS {
+		printTLSSummary(r.TLSStats())
 	}
-	if r.chosenIP != "" {
-		return r.chosenIP
+	if t.opts.HTTP {
+		printHTTPSummary(r.HTTPStats())
 	}
-	return r.host
 }
 
-func (r *Runner) PrintSummary() {
-	printSummary(r.stats, r.opts.VerboseMode, r.DisplayHost(), r.port)
+// jsonReporter writes NDJSON records to stdout (--format json) or to a
+// --json-file.
+type jsonReporter struct {
+	opts   *Options
+	w      io.Writer
+	closer io.Closer // set when the reporter owns w
 }
 
-func (r *Runner) SentCount() int64 {
-	return r.stats.SentCount()
+func (j *jsonReporter) OnStart(*tcping.Runner) {}
+
+func (j *jsonReporter) OnResult(r *tcping.Runner, res tcping.Result) {
+	writeJSONLine(j.w, probeRecordFor(r, res))
 }
 
-func (r *Runner) Run(ctx context.Context) error {
-	if err := r.resolve(ctx); err != nil {
-		return err
-	}
+func (j *jsonReporter) OnResolve(r *tcping.Runner, ev tcping.ResolveEvent) {
+	rec := eventRecord{
+		Type:      "event",
+		Event:     "re_resolve",
+		Timestamp: ev.Time.UTC().Format(time.RFC3339Nano),
+		Host:      r.Host(),
+		Reason:    ev.Reason,
+		OldIP:     ev.OldIP,
+		NewIP:     ev.NewIP,
+		IPs:       ev.IPs,
+	}
+	if ev.Err != nil {
+		rec.Error = ev.Err.Error()
+	}
+	writeJSONLine(j.w, rec)
+}
 
-	r.printIntro()
+func (j *jsonReporter) OnSummary(runners []*tcping.Runner) {
+	for _, r := range runners {
+		writeJSONLine(j.w, summaryRecordFor(j.opts, r))
+	}
+}
 
-	if r.opts.CSVAuto {
-		if r.opts.CSVPath == "" {
-			r.opts.CSVPath = fmt.Sprintf("tcping_results_%s_%s.csv",
-				sanitizeFilename(r.host),
-				time.Now().Format("20060102-150405"))
-		}
-		r.csv = startCSVWriter(r.opts.CSVPath, &r.csvWG, r.opts.CSVFlushEvery, r.opts.CSVFlushTick)
-		defer func() {
-			close(r.csv)
-			r.csvWG.Wait()
-		}()
+func (j *jsonReporter) Close() error {
+	if j.closer == nil {
+		return nil
 	}
+	return j.closer.Close()
+}
 
-	ticker := time.NewTicker(r.opts.Interval)
-	defer ticker.Stop()
+// csvReporter appends one row per probe to the -o/--csv file, shared by
+// all targets. In best-effort mode rows are dropped while the writer is
+// behind; in lossless mode the probing goroutine waits instead.
+type csvReporter struct {
+	opts     *Options
+	lossless bool
 
-	for seq := 1; r.opts.Count == 0 || seq <= r.opts.Count; seq++ {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-		}
+	ch      chan []string
+	wg      sync.WaitGroup
+	dropped atomic.Int64
+}
 
-		r.pingOnce(ctx, seq)
+func (c *csvReporter) OnStart(*tcping.Runner) {}
 
-		if r.opts.Count > 0 && seq == r.opts.Count {
-			break
-		}
+func (c *csvReporter) OnResult(r *tcping.Runner, res tcping.Result) {
+	row := csvRow(c.opts, r, res)
+	if c.lossless {
+		c.ch <- row
+		return
+	}
+	if !sendCSVRow(c.ch, row) {
+		c.dropped.Add(1)
+	}
+}
 
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case <-ticker.C:
-		}
+// OnSummary reports the file and its dropped rows; it goes to stderr in
+// JSON format so that stdout stays machine-readable.
+func (c *csvReporter) OnSummary([]*tcping.Runner) {
+	w := os.Stdout
+	if c.opts.Format == formatJSON {
+		w = os.Stderr
 	}
+	fmt.Fprintf(w, msg("csv.summary"), c.opts.CSVPath, c.dropped.Load())
+}
 
+func (c *csvReporter) Close() error {
+	close(c.ch)
+	c.wg.Wait()
 	return nil
 }
 
-func (r *Runner) printIntro() {
-	if net.ParseIP(r.host) == nil {
-		fmt.Printf("正在对 %s [%s - %s] 端口 %s 执行 TCP Ping\n", r.host, r.ipType, r.chosenIP, r.port)
-	} else {
-		fmt.Printf("正在对 %s 端口 %s 执行 TCP Ping\n", r.host, r.port)
+func displayHost(r *tcping.Runner) string {
+	ip := r.IP()
+	if net.ParseIP(r.Host()) == nil && ip != "" {
+		return fmt.Sprintf("%s [%s]", r.Host(), ip)
 	}
+	if ip != "" {
+		return ip
+	}
+	return r.Host()
+}
 
-	if r.opts.VerboseMode && len(r.allIPs) > 1 {
-		fmt.Printf("域名 %s 解析到的所有IP地址:\n", r.host)
-		for i, ip := range r.allIPs {
-			if ip.To4() != nil {
-				fmt.Printf("  [%d] IPv4: %s\n", i+1, ip.String())
-			} else {
-				fmt.Printf("  [%d] IPv6: %s\n", i+1, ip.String())
+func sentCount(runners []*tcping.Runner) int64 {
+	var n int64
+	for _, r := range runners {
+		n += r.SentCount()
+	}
+	return n
+}
+
+// printStatsTable prints one row per runner, or one row per address for
+// runners in --all-ips mode. lead adds the target column when non-nil.
+func printStatsTable(lead []string, runners []*tcping.Runner) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	// ASCII headers keep tabwriter columns aligned; CJK runes are double width.
+	header := append(lead, "IP", "SENT", "RECV", "LOSS", "MIN", "AVG", "P95", "MAX", "STDDEV", "JITTER")
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, r := range runners {
+		for _, row := range r.PerIP() {
+			cells := []string{orDash(row.IP)}
+			if lead != nil {
+				cells = append([]string{r.Target()}, cells...)
 			}
+			fmt.Fprintln(tw, strings.Join(append(cells, statsCells(row.Stats)...), "\t"))
 		}
-		fmt.Printf("使用IP地址: %s\n\n", r.chosenIP)
 	}
+	_ = tw.Flush()
 }
 
-func (r *Runner) resolve(ctx context.Context) error {
-	if ip := net.ParseIP(r.host); ip != nil {
-		isV4 := ip.To4() != nil
-		if r.opts.UseIPv4 && !isV4 {
-			return fmt.Errorf("地址 %s 不是 IPv4 地址", r.host)
-		}
-		if r.opts.UseIPv6 && isV4 {
-			return fmt.Errorf("地址 %s 不是 IPv6 地址", r.host)
-		}
-		r.allIPs = []net.IP{ip}
-		r.chooseIP(ip)
-		return nil
+func statsCells(s tcping.StatsSnapshot) []string {
+	if s.Sent == 0 {
+		return []string{"0", "0", "-", "-", "-", "-", "-", "-", "-"}
+	}
+	lossRate := float64(s.Sent-s.Received) / float64(s.Sent) * 100
+	cells := []string{strconv.FormatInt(s.Sent, 10), strconv.FormatInt(s.Received, 10), fmt.Sprintf("%.1f%%", lossRate)}
+	if s.RTTCount == 0 {
+		return append(cells, "-", "-", "-", "-", "-", "-")
 	}
+	for _, d := range []time.Duration{s.Min, s.Avg, s.P95, s.Max, s.StdDev, s.JitterAvg} {
+		cells = append(cells, fmt.Sprintf("%.2fms", durMS(d)))
+	}
+	return cells
+}
 
-	dnsCtx, cancel := context.WithTimeout(ctx, r.opts.DNSTimeout)
-	defer cancel()
+// =====================
+// JSON output
+// =====================
 
-	res := net.Resolver{}
-	dnsServerAddr := ""
-	if strings.TrimSpace(r.opts.DNSServer) != "" {
-		var err error
-		dnsServerAddr, err = normalizeDNSServer(r.opts.DNSServer)
-		if err != nil {
-			return fmt.Errorf("DNS 服务器地址无效: %w", err)
+// probeRecord is one NDJSON line per probe in --format json.
+type probeRecord struct {
+	Type       string  `json:"type"`
+	Timestamp  string  `json:"timestamp"`
+	Seq        int     `json:"seq"`
+	Host       string  `json:"host"`
+	IP         string  `json:"ip"`
+	Port       int     `json:"port"`
+	RTTMS      float64 `json:"rtt_ms"`
+	Success    bool    `json:"success"`
+	Error      string  `json:"error,omitempty"`
+	ErrorClass string  `json:"error_class,omitempty"`
+	LocalAddr  string  `json:"local_addr,omitempty"`
+
+	SYNRetransmit bool    `json:"syn_retransmit,omitempty"`
+	PortState     string  `json:"port_state,omitempty"`
+	SRTTMS        float64 `json:"srtt_ms,omitempty"`
+	RTTVarMS      float64 `json:"rttvar_ms,omitempty"`
+	Retrans       uint32  `json:"retrans,omitempty"`
+	SYNRetrans    uint32  `json:"syn_retrans,omitempty"`
+	MSS           uint32  `json:"mss,omitempty"`
+	PMTU          uint32  `json:"pmtu,omitempty"`
+
+	TLSHandshakeMS float64 `json:"tls_handshake_ms,omitempty"`
+	TLSVersion     string  `json:"tls_version,omitempty"`
+	TLSCipher      string  `json:"tls_cipher,omitempty"`
+	TLSALPN        string  `json:"tls_alpn,omitempty"`
+	CertExpiry     string  `json:"cert_expiry,omitempty"`
+
+	HTTPStatus int     `json:"http_status,omitempty"`
+	DNSMS      float64 `json:"dns_ms,omitempty"`
+	TTFBMS     float64 `json:"ttfb_ms,omitempty"`
+	TotalMS    float64 `json:"total_ms,omitempty"`
+}
+
+// summaryRecord is the final NDJSON line for each target.
+type summaryRecord struct {
+	Type      string  `json:"type"`
+	Host      string  `json:"host"`
+	IP        string  `json:"ip"`
+	Port      int     `json:"port"`
+	Sent      int64   `json:"sent"`
+	Received  int64   `json:"received"`
+	Lost      int64   `json:"lost"`
+	Recovered int64   `json:"recovered,omitempty"`
+	LossPct   float64 `json:"loss_pct"`
+	MinMS     float64 `json:"min_ms"`
+	MaxMS     float64 `json:"max_ms"`
+	AvgMS     float64 `json:"avg_ms"`
+	JitterMS  float64 `json:"jitter_ms"`
+	P50MS     float64 `json:"p50_ms"`
+	P90MS     float64 `json:"p90_ms"`
+	P95MS     float64 `json:"p95_ms"`
+	P99MS     float64 `json:"p99_ms"`
+	StdDevMS  float64 `json:"stddev_ms"`
+	MDevMS    float64 `json:"mdev_ms"`
+
+	TLSHandshakeAvgMS float64 `json:"tls_handshake_avg_ms,omitempty"`
+	TLSHandshakeP95MS float64 `json:"tls_handshake_p95_ms,omitempty"`
+
+	Failures map[string]int64  `json:"failures,omitempty"`
+	PerIP    []ipSummaryRecord `json:"per_ip,omitempty"`
+
+	DNSAvgMS         float64          `json:"dns_avg_ms,omitempty"`
+	DNSP95MS         float64          `json:"dns_p95_ms,omitempty"`
+	HTTPStatusCounts map[string]int64 `json:"http_status_counts,omitempty"`
+	TTFBAvgMS        float64          `json:"ttfb_avg_ms,omitempty"`
+	TTFBP95MS        float64          `json:"ttfb_p95_ms,omitempty"`
+	TotalAvgMS       float64          `json:"total_avg_ms,omitempty"`
+	TotalP95MS       float64          `json:"total_p95_ms,omitempty"`
+}
+
+// eventRecord reports run-time changes such as DNS re-resolution.
+type eventRecord struct {
+	Type      string   `json:"type"`
+	Event     string   `json:"event"`
+	Timestamp string   `json:"timestamp"`
+	Host      string   `json:"host"`
+	Reason    string   `json:"reason,omitempty"`
+	OldIP     string   `json:"old_ip,omitempty"`
+	NewIP     string   `json:"new_ip,omitempty"`
+	IPs       []string `json:"ips,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+type ipSummaryRecord struct {
+	IP       string  `json:"ip"`
+	Sent     int64   `json:"sent"`
+	Received int64   `json:"received"`
+	LossPct  float64 `json:"loss_pct"`
+	AvgMS    float64 `json:"avg_ms"`
+	P95MS    float64 `json:"p95_ms"`
+	MaxMS    float64 `json:"max_ms"`
+}
+
+func probeRecordFor(r *tcping.Runner, res tcping.Result) probeRecord {
+	port, _ := strconv.Atoi(r.Port())
+	rec := probeRecord{
+		Type:      "probe",
+		Timestamp: res.Time.UTC().Format(time.RFC3339Nano),
+		Seq:       res.Seq,
+		Host:      r.Host(),
+		IP:        res.IP,
+		Port:      port,
+		RTTMS:     durMS(res.RTT),
+		Success:   res.Success(),
+		LocalAddr: res.LocalAddr,
+
+		SYNRetransmit: res.SYNRetransmit,
+		PortState:     res.PortState,
+	}
+	if res.Err != nil {
+		rec.Error = res.Err.Error()
+		rec.ErrorClass = tcping.ClassifyError(res.Err)
+	}
+	if ti := res.TCPInfo; ti != nil {
+		rec.SRTTMS = durMS(ti.SRTT)
+		rec.RTTVarMS = durMS(ti.RTTVar)
+		rec.Retrans = ti.Retransmits
+		rec.SYNRetrans = ti.SYNRetransmits
+		rec.MSS = ti.MSS
+		rec.PMTU = ti.PMTU
+	}
+	if t := res.TLS; t != nil {
+		rec.TLSHandshakeMS = durMS(t.Handshake)
+		rec.TLSVersion = t.Version
+		rec.TLSCipher = t.Cipher
+		rec.TLSALPN = t.ALPN
+		if !t.CertExpiry.IsZero() {
+			rec.CertExpiry = t.CertExpiry.UTC().Format(time.RFC3339)
 		}
+	}
+	if h := res.HTTP; h != nil {
+		rec.HTTPStatus = h.Status
+		rec.DNSMS = durMS(h.DNS)
+		rec.TTFBMS = durMS(h.TTFB)
+		rec.TotalMS = durMS(h.Total)
+	}
+	return rec
+}
 
-		dialer := &net.Dialer{Timeout: r.opts.DNSTimeout}
-		res = net.Resolver{
-			PreferGo: true,
-			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
-				return dialer.DialContext(ctx, network, dnsServerAddr)
-			},
+func summaryRecordFor(opts *Options, r *tcping.Runner) summaryRecord {
+	rec := statsRecord(r.Host(), r.IP(), r.Port(), r.Stats())
+	if opts.AllIPs != "" {
+		for _, row := range r.PerIP() {
+			ps := row.Stats
+			ir := ipSummaryRecord{IP: row.IP, Sent: ps.Sent, Received: ps.Received,
+				AvgMS: durMS(ps.Avg), P95MS: durMS(ps.P95), MaxMS: durMS(ps.Max)}
+			if ps.Sent > 0 {
+				ir.LossPct = float64(ps.Sent-ps.Received) / float64(ps.Sent) * 100
+			}
+			rec.PerIP = append(rec.PerIP, ir)
 		}
 	}
+	if opts.TLS {
+		ts := r.TLSStats()
+		rec.TLSHandshakeAvgMS = durMS(ts.Avg)
+		rec.TLSHandshakeP95MS = durMS(ts.P95)
+	}
+	if opts.HTTP {
+		h := r.HTTPStats()
+		rec.DNSAvgMS = durMS(h.DNS.Avg)
+		rec.DNSP95MS = durMS(h.DNS.P95)
+		rec.HTTPStatusCounts = statusCounts(h.Status)
+		rec.TTFBAvgMS = durMS(h.TTFB.Avg)
+		rec.TTFBP95MS = durMS(h.TTFB.P95)
+		rec.TotalAvgMS = durMS(h.Total.Avg)
+		rec.TotalP95MS = durMS(h.Total.P95)
+	}
+	return rec
+}
+
+// statsRecord fills the fields of a summary shared by live runs and
+// analyze.
+func statsRecord(host, ip, port string, s tcping.StatsSnapshot) summaryRecord {
+	portNum, _ := strconv.Atoi(port)
+	rec := summaryRecord{
+		Type:      "summary",
+		Host:      host,
+		IP:        ip,
+		Port:      portNum,
+		Sent:      s.Sent,
+		Received:  s.Received,
+		Lost:      s.Sent - s.Received,
+		Recovered: s.Recovered,
+		MinMS:     durMS(s.Min),
+		MaxMS:     durMS(s.Max),
+		AvgMS:     durMS(s.Avg),
+		JitterMS:  durMS(s.JitterAvg),
+		Failures:  s.Failures,
+		P50MS:     durMS(s.P50),
+		P90MS:     durMS(s.P90),
+		P95MS:     durMS(s.P95),
+		P99MS:     durMS(s.P99),
+		StdDevMS:  durMS(s.StdDev),
+		MDevMS:    durMS(s.MDev),
+	}
+	if s.Sent > 0 {
+		rec.LossPct = float64(rec.Lost) / float64(s.Sent) * 100
+	}
+	return rec
+}
+
+// writeJSONLine writes v as a single line so concurrent runners never
+// interleave within a record.
+func writeJSONLine(w io.Writer, v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		fmt.Fprintf(stderr, msg("err.json_encode"), err)
+		return
+	}
+	b = append(b, '\n')
+	_, _ = w.Write(b)
+}
+
+// =====================
+// Prometheus metrics
+// =====================
 
-	ipAddrs, err := res.LookupIPAddr(dnsCtx, r.host)
+// startMetricsServer binds addr synchronously so a bad address fails at
+// startup, then serves /metrics in the background for the life of the process.
+func startMetricsServer(addr string, runners []*tcping.Runner) error {
+	ln, err := net.Listen("tcp", addr)
 	if err != nil {
-		if dnsServerAddr != "" {
-			return fmt.Errorf("通过 DNS 服务器 %s 解析 %s 失败: %w", dnsServerAddr, r.host, err)
+		return fmt.Errorf(msg("err.metrics_listen"), addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writeMetrics(w, runners)
+	})
+
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Fprintf(stderr, msg("err.metrics_serve"), err)
+		}
+	}()
+	return nil
+}
+
+func writeMetrics(w io.Writer, runners []*tcping.Runner) {
+	var (
+		snaps  []tcping.StatsSnapshot
+		labels []string
+	)
+	for _, r := range runners {
+		for _, row := range r.PerIP() {
+			snaps = append(snaps, row.Stats)
+			labels = append(labels, fmt.Sprintf(`target="%s",ip="%s"`, promEscape(r.Target()), promEscape(row.IP)))
 		}
-		return fmt.Errorf("解析 %s 失败: %w", r.host, err)
 	}
-	if len(ipAddrs) == 0 {
-		return fmt.Errorf("未找到 %s 的 IP 地址", r.host)
+
+	metricHeader(w, "tcping_probes_sent_total", "counter", "Total TCP connect attempts.")
+	for i, s := range snaps {
+		fmt.Fprintf(w, "tcping_probes_sent_total{%s} %d\n", labels[i], s.Sent)
 	}
 
-	r.allIPs = make([]net.IP, 0, len(ipAddrs))
-	for _, a := range ipAddrs {
-		r.allIPs = append(r.allIPs, a.IP)
+	metricHeader(w, "tcping_probes_received_total", "counter", "Total successful TCP connects.")
+	for i, s := range snaps {
+		fmt.Fprintf(w, "tcping_probes_received_total{%s} %d\n", labels[i], s.Received)
 	}
 
-	var chosen net.IP
-	if r.opts.UseIPv4 {
-		for _, ip := range r.allIPs {
-			if ip.To4() != nil {
-				chosen = ip
-				break
-			}
-		}
-		if chosen == nil {
-			return fmt.Errorf("未找到 %s 的 IPv4 地址", r.host)
+	metricHeader(w, "tcping_probes_recovered_total", "counter", "Successful TCP connects that needed a SYN retransmission.")
+	for i, s := range snaps {
+		fmt.Fprintf(w, "tcping_probes_recovered_total{%s} %d\n", labels[i], s.Recovered)
+	}
+
+	metricHeader(w, "tcping_probe_failures_total", "counter", "Failed TCP connects by error class.")
+	for i, s := range snaps {
+		for _, class := range sortedKeys(s.Failures) {
+			fmt.Fprintf(w, "tcping_probe_failures_total{%s,class=\"%s\"} %d\n", labels[i], promEscape(class), s.Failures[class])
 		}
-	} else if r.opts.UseIPv6 {
-		for _, ip := range r.allIPs {
-			if ip.To4() == nil {
-				chosen = ip
-				break
-			}
+	}
+
+	metricHeader(w, "tcping_up", "gauge", "Whether the most recent probe succeeded.")
+	for i, s := range snaps {
+		up := 0
+		if s.LastSuccess {
+			up = 1
 		}
-		if chosen == nil {
-			return fmt.Errorf("未找到 %s 的 IPv6 地址", r.host)
+		fmt.Fprintf(w, "tcping_up{%s} %d\n", labels[i], up)
+	}
+
+	metricHeader(w, "tcping_rtt_seconds", "histogram", "TCP connect round-trip time of successful probes.")
+	for i, s := range snaps {
+		for j, b := range tcping.RTTBucketBounds {
+			fmt.Fprintf(w, "tcping_rtt_seconds_bucket{%s,le=\"%s\"} %d\n",
+				labels[i], strconv.FormatFloat(b.Seconds(), 'g', -1, 64), s.RTTBuckets[j])
 		}
-	} else {
-		for _, ip := range r.allIPs {
-			if ip.To4() != nil {
-				chosen = ip
-				break
-			}
+		fmt.Fprintf(w, "tcping_rtt_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels[i], s.RTTCount)
+		fmt.Fprintf(w, "tcping_rtt_seconds_sum{%s} %s\n", labels[i], strconv.FormatFloat(s.Sum.Seconds(), 'g', -1, 64))
+		fmt.Fprintf(w, "tcping_rtt_seconds_count{%s} %d\n", labels[i], s.RTTCount)
+	}
+}
+
+func metricHeader(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func promEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+// =====================
+// TLS output
+// =====================
+
+func tlsCSVFields(t *tcping.TLSInfo) []string {
+	if t == nil {
+		return []string{"", "", "", "", ""}
+	}
+	expiry := ""
+	if !t.CertExpiry.IsZero() {
+		expiry = t.CertExpiry.UTC().Format(time.RFC3339)
+	}
+	return []string{fmt.Sprintf("%.2f", durMS(t.Handshake)), t.Version, t.Cipher, t.ALPN, expiry}
+}
+
+func formatCertExpiry(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	days := int(time.Until(t).Hours() / 24)
+	return fmt.Sprintf(msg("tls.cert_expiry"), t.Local().Format("2006-01-02 15:04:05"), days)
+}
+
+func printTLSSummary(s tcping.StatsSnapshot) {
+	if s.Sent == 0 {
+		return
+	}
+	fmt.Printf(msg("summary.tls"), s.Received, s.Sent-s.Received)
+	if s.Received > 0 {
+		fmt.Printf(msg("summary.tls_rtt"),
+			durMS(s.Min), durMS(s.Max), durMS(s.Avg), durMS(s.P95))
+	}
+	fmt.Println()
+}
+
+// =====================
+// HTTP output
+// =====================
+
+// statusCounts keys HTTP status counts by their string form for JSON and
+// sorted display.
+func statusCounts(status map[int]int64) map[string]int64 {
+	out := make(map[string]int64, len(status))
+	for code, n := range status {
+		out[strconv.Itoa(code)] = n
+	}
+	return out
+}
+
+// parseStatusRanges parses "200-399,418" style --http-status values.
+func parseStatusRanges(spec string) ([]tcping.StatusRange, error) {
+	var out []tcping.StatusRange
+	for _, part := range splitList(spec) {
+		lo, hi, isRange := strings.Cut(part, "-")
+		a, err := strconv.Atoi(strings.TrimSpace(lo))
+		if err != nil {
+			return nil, fmt.Errorf(msg("err.status_code"), part)
 		}
-		if chosen == nil {
-			for _, ip := range r.allIPs {
-				if ip.To4() == nil {
-					chosen = ip
-					break
-				}
+		b := a
+		if isRange {
+			if b, err = strconv.Atoi(strings.TrimSpace(hi)); err != nil {
+				return nil, fmt.Errorf(msg("err.status_code"), part)
 			}
 		}
-		if chosen == nil {
-			return fmt.Errorf("未找到 %s 的可用 IP 地址", r.host)
+		if a < 100 || b > 999 || a > b {
+			return nil, fmt.Errorf(msg("err.status_range"), part)
 		}
+		out = append(out, tcping.StatusRange{Lo: a, Hi: b})
 	}
-
-	r.chooseIP(chosen)
-	return nil
+	if len(out) == 0 {
+		return nil, errors.New(msg("err.status_empty"))
+	}
+	return out, nil
 }
 
-func (r *Runner) chooseIP(ip net.IP) {
-	if ip.To4() != nil {
-		r.ipType = "IPv4"
-	} else {
-		r.ipType = "IPv6"
+// headerList collects repeated -H/--header flags.
+type headerList []string
+
+func (h *headerList) String() string     { return strings.Join(*h, ", ") }
+func (h *headerList) Set(v string) error { *h = append(*h, v); return nil }
+
+func parseHeader(raw string) (name, value string, err error) {
+	name, value, ok := strings.Cut(raw, ":")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return "", "", fmt.Errorf(msg("err.header"), raw)
 	}
-	r.chosenIP = ip.String()
+	return name, strings.TrimSpace(value), nil
 }
 
-func (r *Runner) pingOnce(ctx context.Context, seq int) {
-	dialCtx, cancel := context.WithTimeout(ctx, r.opts.Timeout)
-	defer cancel()
+// parseHeaders turns the validated -H values into request headers.
+func parseHeaders(raw []string) http.Header {
+	if len(raw) == 0 {
+		return nil
+	}
+	h := make(http.Header)
+	for _, line := range raw {
+		name, value, _ := parseHeader(line)
+		h.Add(name, value)
+	}
+	return h
+}
 
-	start := time.Now()
-	addr := net.JoinHostPort(r.chosenIP, r.port)
+func formatHTTPTimings(connect time.Duration, tlsInfo *tcping.TLSInfo, h *tcping.HTTPInfo) string {
+	var b strings.Builder
+	if h != nil && h.DNS > 0 {
+		fmt.Fprintf(&b, "dns=%.2fms ", durMS(h.DNS))
+	}
+	if connect == 0 {
+		// The lookup failed before anything was dialed.
+		return strings.TrimSpace(b.String())
+	}
+	fmt.Fprintf(&b, "connect=%.2fms", durMS(connect))
+	if tlsInfo != nil {
+		fmt.Fprintf(&b, " tls=%.2fms", durMS(tlsInfo.Handshake))
+	}
+	if h != nil && h.Status != 0 {
+		fmt.Fprintf(&b, " ttfb=%.2fms total=%.2fms", durMS(h.TTFB), durMS(h.Total))
+	}
+	return b.String()
+}
 
-	conn, err := (&net.Dialer{}).DialContext(dialCtx, "tcp", addr)
-	rtt := time.Since(start)
+func httpCSVFields(h *tcping.HTTPInfo) []string {
+	if h == nil {
+		return []string{"", "", "", ""}
+	}
+	dns := ""
+	if h.DNS > 0 {
+		dns = fmt.Sprintf("%.2f", durMS(h.DNS))
+	}
+	if h.Status == 0 {
+		return []string{"", "", "", dns}
+	}
+	return []string{strconv.Itoa(h.Status), fmt.Sprintf("%.2f", durMS(h.TTFB)), fmt.Sprintf("%.2f", durMS(h.Total)), dns}
+}
 
-	if ctx.Err() != nil {
-		if conn != nil {
-			_ = conn.Close()
-		}
+func printHTTPSummary(h tcping.HTTPSnapshot) {
+	counts := statusCounts(h.Status)
+	if len(counts) == 0 {
 		return
 	}
+	parts := make([]string, 0, len(counts))
+	for _, code := range sortedKeys(counts) {
+		parts = append(parts, fmt.Sprintf("%s = %d", code, counts[code]))
+	}
+	fmt.Printf(msg("summary.http_status"), strings.Join(parts, ", "))
 
-	success := err == nil
-	r.stats.Update(rtt, success)
-
-	ts := time.Now().UTC().Format(time.RFC3339Nano)
-	prefix := ""
-	if r.opts.ShowTimestamp {
-		prefix = "[" + formatDisplayTimestamp(time.Now()) + "] "
-	}
-
-	if !success {
-		fmt.Print(errorText(fmt.Sprintf("%sTCP连接失败 %s:%s: seq=%d 错误=%v\n", prefix, r.chosenIP, r.port, seq, err), r.opts.ColorOutput))
-		if r.opts.VerboseMode {
-			fmt.Printf("%s  详细信息: 连接尝试耗时 %.2fms, 目标 %s\n", prefix, durMS(rtt), addr)
-		}
-		sendCSVRow(r.csv, []string{
-			ts,
-			strconv.Itoa(seq),
-			r.host,
-			r.chosenIP,
-			r.port,
-			fmt.Sprintf("%.2f", durMS(rtt)),
-			"false",
-			fmt.Sprintf("%v", err),
-			"",
-		})
-		return
+	ttfb, total := h.TTFB, h.Total
+	dns := ""
+	if h.DNS.Received > 0 {
+		dns = fmt.Sprintf(msg("summary.http_dns"), durMS(h.DNS.Avg), durMS(h.DNS.P95))
 	}
-	defer func() {
-		if cerr := conn.Close(); cerr != nil && r.opts.VerboseMode {
-			fmt.Printf("  关闭连接时出错: %v\n", cerr)
-		}
-	}()
+	fmt.Printf(msg("summary.http_timing"),
+		dns, durMS(ttfb.Avg), durMS(ttfb.P95), durMS(total.Avg), durMS(total.P95))
+}
 
-	localAddr := conn.LocalAddr().String()
+// =====================
+// Error labels
+// =====================
 
-	fmt.Print(successText(fmt.Sprintf("%s从 %s:%s 收到响应: seq=%d time=%.2fms\n", prefix, r.chosenIP, r.port, seq, durMS(rtt)), r.opts.ColorOutput))
-	if r.opts.VerboseMode {
-		fmt.Printf("%s  详细信息: 本地地址=%s, 远程地址=%s\n", prefix, localAddr, addr)
+func errorClassLabel(class string) string {
+	key := "class." + class
+	if l := msg(key); l != key {
+		return l
 	}
+	return class
+}
 
-	sendCSVRow(r.csv, []string{
-		ts,
-		strconv.Itoa(seq),
-		r.host,
-		r.chosenIP,
-		r.port,
-		fmt.Sprintf("%.2f", durMS(rtt)),
-		"true",
-		"",
-		localAddr,
-	})
+// formatFailures renders per-class failure counts, most frequent first.
+func formatFailures(failures map[string]int64) string {
+	classes := sortedKeys(failures)
+	sort.SliceStable(classes, func(i, j int) bool { return failures[classes[i]] > failures[classes[j]] })
+	parts := make([]string, 0, len(classes))
+	for _, c := range classes {
+		parts = append(parts, fmt.Sprintf("%s = %d", errorClassLabel(c), failures[c]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// localizeError renders errors from the tcping package in the output
+// language; other errors, mostly from the standard library, pass through.
+// It is for console lines only: CSV and JSON keep the raw error text.
+func localizeError(err error) string {
+	var (
+		re *tcping.ResolveError
+		te *tcping.TLSError
+		he *tcping.HTTPError
+		se *tcping.HTTPStatusError
+	)
+	switch {
+	case errors.Is(err, tcping.ErrNoTargets):
+		return msg("err.all_targets_failed")
+	case errors.As(err, &se):
+		return fmt.Sprintf(msg("err.http_status"), se.Code)
+	case errors.As(err, &te):
+		return msg("err.tls") + te.Err.Error()
+	case errors.As(err, &he):
+		return msg("err.http") + he.Err.Error()
+	case errors.As(err, &re):
+		return resolveErrorText(re)
+	}
+	return err.Error()
+}
+
+func resolveErrorText(e *tcping.ResolveError) string {
+	switch {
+	case errors.Is(e.Err, tcping.ErrNotIPv4):
+		return fmt.Sprintf(msg("err.not_ipv4"), e.Host)
+	case errors.Is(e.Err, tcping.ErrNotIPv6):
+		return fmt.Sprintf(msg("err.not_ipv6"), e.Host)
+	case errors.Is(e.Err, tcping.ErrNoAddress):
+		return fmt.Sprintf(msg("err.no_ip"), e.Host)
+	case errors.Is(e.Err, tcping.ErrNoIPv4Address):
+		return fmt.Sprintf(msg("err.no_ipv4"), e.Host)
+	case errors.Is(e.Err, tcping.ErrNoIPv6Address):
+		return fmt.Sprintf(msg("err.no_ipv6"), e.Host)
+	case e.Server != "":
+		return fmt.Errorf(msg("err.resolve_via"), e.Server, e.Host, e.Err).Error()
+	}
+	return fmt.Errorf(msg("err.resolve"), e.Host, e.Err).Error()
 }
 
 // =====================
 // CSV writer
 // =====================
 
-func startCSVWriter(path string, wg *sync.WaitGroup, flushEvery int, flushTick time.Duration) chan []string {
+func csvHeader(opts *Options) []string {
+	h := []string{"timestamp", "seq", "host", "ip", "port", "elapsed_ms", "success", "error", "local_addr", "error_class",
+		"srtt_ms", "rttvar_ms", "retrans", "syn_retrans", "mss", "pmtu", "syn_retransmit"}
+	if opts.SYN {
+		h = append(h, "port_state")
+	}
+	if opts.TLS {
+		h = append(h, "tls_handshake_ms", "tls_version", "tls_cipher", "tls_alpn", "cert_expiry")
+	}
+	if opts.HTTP {
+		h = append(h, "http_status", "ttfb_ms", "total_ms", "dns_ms")
+	}
+	return h
+}
+
+// startCSVWriter takes ownership of f and writes the rows received on the
+// returned channel until it is closed. Every file it starts, including
+// those opened after a rotation, begins with header.
+func startCSVWriter(f *os.File, header []string, wg *sync.WaitGroup, flushEvery int, flushTick time.Duration, rot csvRotation) chan []string {
 	if flushEvery <= 0 {
 		flushEvery = defaultCSVFlushEvery
 	}
@@ -450,38 +1078,109 @@ func startCSVWriter(path string, wg *sync.WaitGroup, flushEvery int, flushTick t
 	ch := make(chan []string, 256)
 	wg.Add(1)
 
+	var rotated chan string
+	if rot.enabled() {
+		rotated = make(chan string, 16)
+		wg.Add(1)
+		go archiveCSV(f.Name(), rotated, rot, wg)
+	}
+
 	go func(ch <-chan []string) {
 		defer wg.Done()
+		if rotated != nil {
+			defer close(rotated)
+		}
 
-		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "无法打开 CSV 文件 %s: %v\n", path, err)
-			for range ch {
+		path := f.Name()
+		var (
+			w      *csv.Writer
+			bw     *bufio.Writer
+			cw     *countingWriter
+			opened time.Time
+			rows   int // rows written to the current file
+		)
+		// size counts rows as they are written, not only once flushed.
+		size := func() int64 { return cw.n + int64(bw.Buffered()) }
+		closeFile := func() {
+			_ = f.Sync()
+			if cerr := f.Close(); cerr != nil {
+				fmt.Fprintf(stderr, msg("csv.close"), cerr)
 			}
-			return
 		}
 		defer func() {
-			_ = f.Sync()
-			if cerr := f.Close(); cerr != nil {
-				fmt.Fprintf(os.Stderr, "关闭 CSV 文件失败: %v\n", cerr)
+			if f != nil {
+				closeFile()
 			}
 		}()
 
-		w := csv.NewWriter(f)
-
 		repl := strings.NewReplacer("\n", " ", "\r", " ")
 		flush := func() {
 			w.Flush()
 			if err := w.Error(); err != nil {
-				fmt.Fprintf(os.Stderr, "CSV flush 错误: %v\n", err)
+				fmt.Fprintf(stderr, msg("csv.flush"), err)
 			}
 		}
 
-		if fi, err := f.Stat(); err == nil && fi.Size() == 0 {
-			if err := w.Write([]string{"timestamp", "seq", "host", "ip", "port", "elapsed_ms", "success", "error", "local_addr"}); err != nil {
-				fmt.Fprintf(os.Stderr, "写入 CSV header 失败: %v\n", err)
+		start := func() {
+			cw = &countingWriter{w: f}
+			// csv.NewWriter reuses a large enough *bufio.Writer as is, so
+			// bw holds exactly the bytes of the rows not yet flushed.
+			bw = bufio.NewWriter(cw)
+			w = csv.NewWriter(bw)
+			opened = time.Now()
+			rows = 0
+			if fi, err := f.Stat(); err == nil {
+				cw.n = fi.Size()
+			}
+			if cw.n == 0 {
+				if err := w.Write(header); err != nil {
+					fmt.Fprintf(stderr, msg("csv.header"), err)
+				}
+				flush()
 			}
+		}
+		start()
+
+		// rotate closes the current file, hands it to archiveCSV under its
+		// numbered name and starts a fresh one at path. It returns false
+		// when path cannot be reopened. Numbering continues after files
+		// left by earlier runs on the same path.
+		seq := lastRotatedIndex(path)
+		rotate := func() bool {
 			flush()
+			closeFile()
+			f = nil
+			seq++
+			dst := rotatedName(path, seq)
+			if err := os.Rename(path, dst); err != nil {
+				fmt.Fprintf(stderr, msg("csv.rotate"), path, err)
+			} else {
+				rotated <- dst
+			}
+			nf, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+			if err != nil {
+				fmt.Fprintf(stderr, msg("csv.reopen"), path, err)
+				return false
+			}
+			f = nf
+			start()
+			return true
+		}
+		// maybeRotate never rotates out a file without rows: after an
+		// idle period the file just moves on to the current period.
+		maybeRotate := func() bool {
+			if !rot.enabled() {
+				return true
+			}
+			now := time.Now()
+			if rows == 0 {
+				opened = now
+				return true
+			}
+			if rot.due(size(), opened, now) {
+				return rotate()
+			}
+			return true
 		}
 
 		t := time.NewTicker(flushTick)
@@ -496,27 +1195,252 @@ func startCSVWriter(path string, wg *sync.WaitGroup, flushEvery int, flushTick t
 					return
 				}
 
-				for i, v := range row {
-					v = repl.Replace(v)
-					row[i] = protectCSVFormula(v)
-				}
+				for i, v := range row {
+					v = repl.Replace(v)
+					row[i] = protectCSVFormula(v)
+				}
+
+				if err := w.Write(row); err != nil {
+					fmt.Fprintf(stderr, msg("csv.write"), err)
+					continue
+				}
+				rowCount++
+				rows++
+				if rowCount%flushEvery == 0 {
+					flush()
+				}
+				if !maybeRotate() {
+					for range ch {
+					}
+					return
+				}
+
+			case <-t.C:
+				flush()
+				if !maybeRotate() {
+					for range ch {
+					}
+					return
+				}
+			}
+		}
+	}(ch)
+
+	return ch
+}
+
+// csvRotation controls how startCSVWriter splits a long run into several
+// files. The zero value never rotates.
+type csvRotation struct {
+	Size  int64         // rotate once the file reaches this many bytes, 0 = off
+	Every time.Duration // rotate at each multiple of this period, 0 = off
+	Keep  int           // rotated files to keep, oldest removed first, 0 = all
+	Gzip  bool          // compress rotated files
+}
+
+func (rot csvRotation) enabled() bool { return rot.Size > 0 || rot.Every > 0 }
+
+// due reports whether a file opened at opened and holding size bytes
+// should be rotated now. Periods are aligned to multiples of Every on the
+// local clock so that e.g. 1h files start on the hour and 24h files at
+// midnight.
+func (rot csvRotation) due(size int64, opened, now time.Time) bool {
+	if rot.Size > 0 && size >= rot.Size {
+		return true
+	}
+	return rot.Every > 0 && !truncateLocal(now, rot.Every).Equal(truncateLocal(opened, rot.Every))
+}
+
+// truncateLocal is t.Truncate(d) on the local wall clock instead of UTC,
+// which matters in zones with a non-hour offset such as UTC+5:30.
+func truncateLocal(t time.Time, d time.Duration) time.Time {
+	_, offset := t.Zone()
+	shift := time.Duration(offset) * time.Second
+	return t.Add(shift).Truncate(d).Add(-shift)
+}
+
+// rotatedName numbers rotated files in the order they were closed:
+// tcping_results_x.csv -> tcping_results_x.1.csv, .2.csv, ...
+func rotatedName(path string, n int) string {
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s.%d%s", strings.TrimSuffix(path, ext), n, ext)
+}
+
+// lastRotatedIndex returns the highest n for which rotatedName(path, n),
+// optionally gzipped, already exists, or 0 when there is none.
+func lastRotatedIndex(path string) int {
+	files := rotatedFiles(path)
+	if len(files) == 0 {
+		return 0
+	}
+	return files[len(files)-1].n
+}
+
+type rotatedFile struct {
+	n    int
+	path string
+}
+
+// rotatedFiles lists the numbered siblings of path on disk, gzipped or
+// not, oldest first. Files left by earlier runs are included.
+func rotatedFiles(path string) []rotatedFile {
+	dir := filepath.Dir(path)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	ext := filepath.Ext(path)
+	prefix := strings.TrimSuffix(filepath.Base(path), ext) + "."
+	var files []rotatedFile
+	for _, e := range entries {
+		name := strings.TrimSuffix(e.Name(), ".gz")
+		if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		num := strings.TrimSuffix(strings.TrimPrefix(name, prefix), ext)
+		if n, err := strconv.Atoi(num); err == nil && n > 0 && strconv.Itoa(n) == num {
+			files = append(files, rotatedFile{n: n, path: filepath.Join(dir, e.Name())})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].n < files[j].n })
+	return files
+}
+
+// countingWriter tracks the size of the file being written.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// archiveCSV compresses and prunes the files rotated from csvPath one at a
+// time so the writer never waits for gzip. Keep counts every numbered file
+// on disk, including those of earlier runs.
+func archiveCSV(csvPath string, rotated <-chan string, rot csvRotation, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	for path := range rotated {
+		if rot.Gzip {
+			if err := gzipFile(path); err != nil {
+				fmt.Fprintf(stderr, msg("csv.gzip"), path, err)
+			}
+		}
+		if rot.Keep <= 0 {
+			continue
+		}
+		files := rotatedFiles(csvPath)
+		for _, old := range files[:max(len(files)-rot.Keep, 0)] {
+			if err := os.Remove(old.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				fmt.Fprintf(stderr, msg("csv.remove"), old.path, err)
+			}
+		}
+	}
+}
+
+// gzipFile replaces path with path.gz. It never overwrites an existing
+// path.gz.
+func gzipFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
 
-				if err := w.Write(row); err != nil {
-					fmt.Fprintf(os.Stderr, "CSV 写入错误: %v\n", err)
-					continue
-				}
-				rowCount++
-				if rowCount%flushEvery == 0 {
-					flush()
-				}
+	out, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	zw.Name = filepath.Base(path)
+	if _, err = io.Copy(zw, in); err == nil {
+		err = zw.Close()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(path + ".gz")
+		return err
+	}
+	_ = in.Close()
+	return os.Remove(path)
+}
 
-			case <-t.C:
-				flush()
-			}
+// parseByteSize parses sizes such as 500000, 512K, 100M or 1G (1024-based,
+// an optional trailing B is ignored).
+func parseByteSize(s string) (int64, error) {
+	s = strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B")
+	mult := int64(1)
+	if n := len(s); n > 0 {
+		switch s[n-1] {
+		case 'K':
+			mult = 1 << 10
+		case 'M':
+			mult = 1 << 20
+		case 'G':
+			mult = 1 << 30
 		}
-	}(ch)
+		if mult > 1 {
+			s = s[:n-1]
+		}
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || v < 0 {
+		return 0, errors.New(s)
+	}
+	return v * mult, nil
+}
 
-	return ch
+func csvRow(opts *Options, r *tcping.Runner, res tcping.Result) []string {
+	errText, errClass, success := "", "", "true"
+	if res.Err != nil {
+		errText, errClass, success = res.Err.Error(), tcping.ClassifyError(res.Err), "false"
+	}
+	row := []string{
+		res.Time.UTC().Format(time.RFC3339Nano),
+		strconv.Itoa(res.Seq),
+		r.Host(),
+		res.IP,
+		r.Port(),
+		fmt.Sprintf("%.2f", durMS(res.RTT)),
+		success,
+		errText,
+		res.LocalAddr,
+		errClass,
+	}
+	row = append(row, tcpInfoCSVFields(res.TCPInfo)...)
+	row = append(row, strconv.FormatBool(res.SYNRetransmit))
+	if opts.SYN {
+		row = append(row, res.PortState)
+	}
+	if opts.TLS {
+		row = append(row, tlsCSVFields(res.TLS)...)
+	}
+	if opts.HTTP {
+		row = append(row, httpCSVFields(res.HTTP)...)
+	}
+	return row
+}
+
+// tcpInfoCSVFields leaves the columns empty for failed probes and on
+// platforms without TCP_INFO.
+func tcpInfoCSVFields(ti *tcping.TCPInfo) []string {
+	if ti == nil {
+		return []string{"", "", "", "", "", ""}
+	}
+	return []string{
+		fmt.Sprintf("%.2f", durMS(ti.SRTT)),
+		fmt.Sprintf("%.2f", durMS(ti.RTTVar)),
+		strconv.FormatUint(uint64(ti.Retransmits), 10),
+		strconv.FormatUint(uint64(ti.SYNRetransmits), 10),
+		strconv.FormatUint(uint64(ti.MSS), 10),
+		strconv.FormatUint(uint64(ti.PMTU), 10),
+	}
 }
 
 func protectCSVFormula(s string) string {
@@ -531,13 +1455,13 @@ func protectCSVFormula(s string) string {
 	}
 }
 
-func sendCSVRow(ch chan<- []string, row []string) {
-	if ch == nil {
-		return
-	}
+// sendCSVRow queues row without blocking and reports whether it fit.
+func sendCSVRow(ch chan<- []string, row []string) bool {
 	select {
 	case ch <- row:
+		return true
 	default:
+		return false
 	}
 }
 
@@ -555,6 +1479,8 @@ func setupFlags(opts *Options) {
 
 	flag.IntVar(&opts.Count, "n", 0, "")
 	flag.IntVar(&opts.Count, "count", 0, "")
+	flag.DurationVar(&opts.Duration, "duration", 0, "")
+	flag.StringVar(&opts.Deadline, "deadline", "", "")
 
 	intervalMS := flag.Int("t", 1000, "")
 	flag.IntVar(intervalMS, "interval", 1000, "")
@@ -564,10 +1490,40 @@ func setupFlags(opts *Options) {
 
 	dnsTimeoutMS := flag.Int("dns-timeout", 1500, "")
 	flag.StringVar(&opts.DNSServer, "dns-server", "", "")
+	flag.StringVar(&opts.AllIPs, "all-ips", "", "")
+	flag.DurationVar(&opts.ReResolve, "re-resolve", 0, "")
+	flag.IntVar(&opts.ReResolveFailures, "re-resolve-failures", 0, "")
+	flag.StringVar(&opts.Source, "source", "", "")
+	flag.StringVar(&opts.Interface, "interface", "", "")
+	flag.IntVar(&opts.TOSFlag, "tos", -1, "")
+	flag.IntVar(&opts.DSCP, "dscp", -1, "")
+	flag.IntVar(&opts.TTL, "ttl", 0, "")
+	flag.Uint64Var(&opts.FWMark, "fwmark", 0, "")
 
 	flag.IntVar(&opts.Port, "p", defaultPort, "")
 	flag.IntVar(&opts.Port, "port", defaultPort, "")
 
+	flag.StringVar(&opts.TargetsFile, "targets-file", "", "")
+	flag.IntVar(&opts.Concurrency, "concurrency", 0, "")
+	flag.IntVar(&opts.InFlight, "in-flight", 0, "")
+	flag.BoolVar(&opts.ExcludeRecovered, "exclude-recovered", false, "")
+
+	flag.StringVar(&opts.MetricsListen, "metrics-listen", "", "")
+
+	flag.BoolVar(&opts.SYN, "syn", false, "")
+	flag.BoolVar(&opts.TLS, "tls", false, "")
+	flag.StringVar(&opts.SNI, "sni", "", "")
+	alpn := flag.String("alpn", "", "")
+	flag.BoolVar(&opts.TLSInsecure, "insecure", false, "")
+
+	flag.BoolVar(&opts.HTTP, "http", false, "")
+	flag.StringVar(&opts.HTTPMethod, "http-method", http.MethodGet, "")
+	flag.StringVar(&opts.HTTPPath, "http-path", "/", "")
+	flag.StringVar(&opts.HTTPHost, "http-host", "", "")
+	flag.StringVar(&opts.HTTPStatus, "http-status", "200-399", "")
+	flag.Var((*headerList)(&opts.HTTPHeaders), "H", "")
+	flag.Var((*headerList)(&opts.HTTPHeaders), "header", "")
+
 	flag.BoolVar(&opts.ColorOutput, "c", false, "")
 	flag.BoolVar(&opts.ColorOutput, "color", false, "")
 
@@ -577,10 +1533,26 @@ func setupFlags(opts *Options) {
 	flag.BoolVar(&opts.ShowTimestamp, "D", false, "")
 	flag.BoolVar(&opts.ShowTimestamp, "timestamp", false, "")
 
+	flag.StringVar(&opts.Format, "format", formatText, "")
+	flag.StringVar(&opts.JSONFile, "json-file", "", "")
+	flag.BoolVar(&opts.TUI, "tui", false, "")
+
 	flag.BoolVar(&opts.CSVAuto, "o", false, "")
 	flag.BoolVar(&opts.CSVAuto, "csv", false, "")
+	flag.StringVar(&opts.CSVMode, "csv-mode", csvModeBestEffort, "")
 	flag.IntVar(&opts.CSVFlushEvery, "csv-flush-every", defaultCSVFlushEvery, "")
 	csvFlushTickMS := flag.Int("csv-flush-tick", int(defaultCSVFlushTick/time.Millisecond), "")
+	flag.StringVar(&opts.CSVRotateSize, "csv-rotate-size", "", "")
+	flag.DurationVar(&opts.CSVRotateEvery, "csv-rotate-every", 0, "")
+	flag.IntVar(&opts.CSVKeep, "csv-keep", 0, "")
+	flag.BoolVar(&opts.CSVGzip, "csv-gzip", false, "")
+
+	flag.Float64Var(&opts.FailLoss, "fail-loss", math.NaN(), "")
+	failAvgMS := flag.Float64("fail-avg", 0, "")
+	failP95MS := flag.Float64("fail-p95", 0, "")
+	flag.Int64Var(&opts.RequireSuccess, "require-success", 0, "")
+
+	flag.StringVar(&opts.Lang, "lang", "", "")
 
 	flag.BoolVar(&opts.ShowVersion, "V", false, "")
 	flag.BoolVar(&opts.ShowVersion, "version", false, "")
@@ -593,6 +1565,20 @@ func setupFlags(opts *Options) {
 	opts.Timeout = time.Duration(*timeoutMS) * time.Millisecond
 	opts.DNSTimeout = time.Duration(*dnsTimeoutMS) * time.Millisecond
 	opts.CSVFlushTick = time.Duration(*csvFlushTickMS) * time.Millisecond
+	opts.ALPN = splitList(*alpn)
+	opts.FailAvg = time.Duration(*failAvgMS * float64(time.Millisecond))
+	opts.FailP95 = time.Duration(*failP95MS * float64(time.Millisecond))
+}
+
+// splitList splits a comma-separated flag value, dropping empty items.
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
 }
 
 func applyDefaults(opts *Options) {
@@ -604,30 +1590,201 @@ func applyDefaults(opts *Options) {
 	}
 }
 
+// probeConfig completes the embedded tcping.Config from the validated
+// command-line values and routes its events to the reporters.
+func probeConfig(opts *Options, out reporters, multi bool) *tcping.Config {
+	cfg := &opts.Config
+	cfg.DNSServer, _ = normalizeDNSServer(cfg.DNSServer)
+	switch {
+	case opts.TOSFlag >= 0:
+		cfg.TOS = opts.TOSFlag
+	case opts.DSCP >= 0:
+		cfg.TOS = opts.DSCP << 2
+	}
+	cfg.Mark = uint32(opts.FWMark)
+	if opts.HTTP {
+		cfg.HTTPHeader = parseHeaders(opts.HTTPHeaders)
+		cfg.HTTPExpect, _ = parseStatusRanges(opts.HTTPStatus)
+	}
+	cfg.UserAgent = "tcping/" + version
+
+	cfg.OnStart = out.OnStart
+	cfg.OnResult = out.OnResult
+	cfg.OnResolve = out.OnResolve
+	cfg.OnError = func(r *tcping.Runner, err error) {
+		fmt.Fprintf(stderr, msg("err.prefix"), tag(r, multi), localizeError(err))
+	}
+	return cfg
+}
+
+// sockoptSummary lists the socket options set on every probe, e.g.
+// "tos=0xb8 (dscp 46) ttl=5 mark=0x10".
+func sockoptSummary(cfg *tcping.Config) string {
+	var parts []string
+	if cfg.TOS != 0 {
+		parts = append(parts, fmt.Sprintf("tos=%#x (dscp %d)", cfg.TOS, cfg.TOS>>2))
+	}
+	if cfg.TTL != 0 {
+		parts = append(parts, fmt.Sprintf("ttl=%d", cfg.TTL))
+	}
+	if cfg.Mark != 0 {
+		parts = append(parts, fmt.Sprintf("mark=%#x", cfg.Mark))
+	}
+	return strings.Join(parts, " ")
+}
+
 func isValidPort(n int) bool {
 	return n >= 1 && n <= 65535
 }
 
 func validateOptions(opts *Options) error {
 	if opts.UseIPv4 && opts.UseIPv6 {
-		return errors.New("无法同时使用 -4 和 -6 标志")
+		return errors.New(msg("err.ipv4_ipv6"))
 	}
 	if opts.Interval <= 0 {
-		return errors.New("间隔时间必须大于 0")
+		return errors.New(msg("err.interval"))
 	}
 	if opts.Timeout <= 0 {
-		return errors.New("超时时间必须大于 0")
+		return errors.New(msg("err.timeout"))
 	}
 	if opts.DNSTimeout <= 0 {
-		return errors.New("DNS 超时时间必须大于 0")
+		return errors.New(msg("err.dns_timeout"))
 	}
 	if strings.TrimSpace(opts.DNSServer) != "" {
 		if _, err := normalizeDNSServer(opts.DNSServer); err != nil {
-			return fmt.Errorf("DNS 服务器地址无效: %w", err)
+			return fmt.Errorf(msg("err.dns_server"), err)
+		}
+	}
+	if opts.Source != "" {
+		src, err := tcping.ParseSourceAddr(opts.Source)
+		if err != nil {
+			return fmt.Errorf(msg("err.source"), opts.Source)
+		}
+		if v4 := src.IP.To4() != nil; (opts.UseIPv4 && !v4) || (opts.UseIPv6 && v4) {
+			return fmt.Errorf(msg("err.source_family"), opts.Source)
+		}
+		// One local port cannot hold two connections at once.
+		if src.Port != 0 && (opts.InFlight > 1 || opts.AllIPs == tcping.AllIPsEach) {
+			return fmt.Errorf(msg("err.source_port"), opts.Source)
+		}
+	}
+	if opts.TOSFlag >= 0 && opts.DSCP >= 0 {
+		return errors.New(msg("err.tos_dscp"))
+	}
+	if opts.TOSFlag > 255 || opts.TOSFlag < -1 {
+		return errors.New(msg("err.tos"))
+	}
+	if opts.DSCP > 63 || opts.DSCP < -1 {
+		return errors.New(msg("err.dscp"))
+	}
+	if opts.TTL < 0 || opts.TTL > 255 {
+		return errors.New(msg("err.ttl"))
+	}
+	if opts.FWMark > math.MaxUint32 {
+		return errors.New(msg("err.fwmark"))
+	}
+	if runtime.GOOS != "linux" && (opts.Interface != "" || opts.TOSFlag > 0 || opts.DSCP > 0 || opts.TTL > 0 || opts.FWMark > 0) {
+		return errors.New(msg("err.sockopt_os"))
+	}
+	if opts.Interface != "" {
+		if _, err := net.InterfaceByName(opts.Interface); err != nil {
+			return fmt.Errorf(msg("err.interface"), opts.Interface)
 		}
 	}
 	if !isValidPort(opts.Port) {
-		return errors.New("端口号必须是 1 到 65535 之间的整数")
+		return errors.New(msg("err.port"))
+	}
+	switch opts.Format {
+	case formatText, formatJSON:
+	default:
+		return fmt.Errorf(msg("err.format"), opts.Format)
+	}
+	if opts.TUI && opts.Format == formatJSON {
+		return errors.New(msg("err.tui_format"))
+	}
+	switch opts.CSVMode {
+	case csvModeBestEffort, csvModeLossless:
+	default:
+		return fmt.Errorf(msg("err.csv_mode"), opts.CSVMode)
+	}
+	if opts.CSVRotateSize != "" {
+		if _, err := parseByteSize(opts.CSVRotateSize); err != nil {
+			return fmt.Errorf(msg("err.csv_rotate_size"), opts.CSVRotateSize)
+		}
+	}
+	if opts.CSVRotateEvery < 0 {
+		return errors.New(msg("err.csv_rotate_every"))
+	}
+	if opts.CSVKeep < 0 {
+		return errors.New(msg("err.csv_keep"))
+	}
+	if !opts.CSVAuto && (opts.CSVRotateSize != "" || opts.CSVRotateEvery > 0 || opts.CSVKeep > 0 || opts.CSVGzip) {
+		return errors.New(msg("err.csv_flags"))
+	}
+	if !opts.TLS && (opts.SNI != "" || len(opts.ALPN) > 0 || opts.TLSInsecure) {
+		return errors.New(msg("err.tls_flags"))
+	}
+	if opts.SYN {
+		if opts.TLS || opts.HTTP {
+			return errors.New(msg("err.syn_flags"))
+		}
+		if runtime.GOOS != "linux" {
+			return errors.New(msg("err.syn_os"))
+		}
+	}
+	if opts.HTTP {
+		if len(opts.ALPN) > 0 {
+			return errors.New(msg("err.http_alpn"))
+		}
+		if strings.TrimSpace(opts.HTTPMethod) == "" {
+			return errors.New(msg("err.http_method"))
+		}
+		if _, err := parseStatusRanges(opts.HTTPStatus); err != nil {
+			return fmt.Errorf(msg("err.http_status_flag"), err)
+		}
+		for _, h := range opts.HTTPHeaders {
+			if _, _, err := parseHeader(h); err != nil {
+				return err
+			}
+		}
+	}
+	if opts.FailLoss < 0 || opts.FailLoss > 100 {
+		return errors.New(msg("err.fail_loss"))
+	}
+	if opts.FailAvg < 0 || opts.FailP95 < 0 {
+		return errors.New(msg("err.fail_rtt"))
+	}
+	if opts.RequireSuccess < 0 {
+		return errors.New(msg("err.require_success"))
+	}
+	if opts.ReResolve < 0 {
+		return errors.New(msg("err.re_resolve"))
+	}
+	if opts.ReResolveFailures < 0 {
+		return errors.New(msg("err.re_resolve_failures"))
+	}
+	switch opts.AllIPs {
+	case "", tcping.AllIPsRoundRobin, tcping.AllIPsEach:
+	default:
+		return fmt.Errorf(msg("err.all_ips"), opts.AllIPs)
+	}
+	if opts.Concurrency < 0 {
+		return errors.New(msg("err.concurrency"))
+	}
+	if opts.InFlight < 0 {
+		return errors.New(msg("err.in_flight"))
+	}
+	if opts.Duration < 0 {
+		return errors.New(msg("err.duration"))
+	}
+	if opts.Deadline != "" {
+		d, err := time.Parse(time.RFC3339, opts.Deadline)
+		if err != nil {
+			return fmt.Errorf(msg("err.deadline"), opts.Deadline)
+		}
+		if !d.After(time.Now()) {
+			return fmt.Errorf(msg("err.deadline_past"), opts.Deadline)
+		}
 	}
 	return nil
 }
@@ -644,7 +1801,7 @@ func normalizeDNSServer(raw string) (string, error) {
 	}
 
 	if net.ParseIP(host) == nil {
-		return "", fmt.Errorf("DNS 主机必须是 IP 地址: %s", host)
+		return "", fmt.Errorf(msg("err.dns_host"), host)
 	}
 
 	if port == "" {
@@ -653,7 +1810,7 @@ func normalizeDNSServer(raw string) (string, error) {
 
 	portNum, err := strconv.Atoi(port)
 	if err != nil || !isValidPort(portNum) {
-		return "", errors.New("DNS 端口号必须是 1 到 65535 之间的整数")
+		return "", errors.New(msg("err.dns_port"))
 	}
 
 	return net.JoinHostPort(host, port), nil
@@ -661,7 +1818,7 @@ func normalizeDNSServer(raw string) (string, error) {
 
 func parseTarget(opts *Options, args []string) (host string, port string, err error) {
 	if len(args) < 1 {
-		return "", "", errors.New("需要提供主机参数\n\n用法: tcping [选项] <主机> [端口]\n尝试 'tcping -h' 获取更多信息")
+		return "", "", errors.New(msg("err.no_host"))
 	}
 
 	rawHost := strings.TrimSpace(args[0])
@@ -679,12 +1836,156 @@ func parseTarget(opts *Options, args []string) (host string, port string, err er
 
 	portNum, e := strconv.Atoi(p)
 	if e != nil || !isValidPort(portNum) {
-		return "", "", errors.New("端口号必须是 1 到 65535 之间的整数")
+		return "", "", errors.New(msg("err.port"))
 	}
 
 	return h, p, nil
 }
 
+// validateTargets checks the options that depend on the targets. A fixed
+// source port allows only one target, since targets are probed at the same
+// time. For --syn it makes sure raw sockets open in every address family
+// that will be probed: IPv6 with -6, an IPv6 --source or an IPv6 target,
+// IPv4 otherwise.
+func validateTargets(opts *Options, targets []tcping.Target) error {
+	srcV6 := false
+	if opts.Source != "" {
+		if src, err := tcping.ParseSourceAddr(opts.Source); err == nil {
+			if src.Port != 0 && len(targets) > 1 {
+				return fmt.Errorf(msg("err.source_port_targets"), opts.Source)
+			}
+			srcV6 = src.IP.To4() == nil
+		}
+	}
+	if !opts.SYN {
+		return nil
+	}
+	var v4, v6 bool
+	for _, t := range targets {
+		if ip := net.ParseIP(t.Host); opts.UseIPv6 || srcV6 || ip != nil && ip.To4() == nil {
+			v6 = true
+		} else {
+			v4 = true
+		}
+	}
+	for _, family := range []struct{ used, ipv6 bool }{{v4, false}, {v6, true}} {
+		if !family.used {
+			continue
+		}
+		if err := tcping.CheckSYN(family.ipv6); err != nil {
+			return fmt.Errorf(msg("err.syn_perm"), err)
+		}
+	}
+	return nil
+}
+
+// parseTargets collects targets from --targets-file and the positional
+// arguments. The classic "<host> [port]" form keeps working: two arguments
+// where the second is a bare port are treated as one target.
+func parseTargets(opts *Options, args []string) ([]tcping.Target, error) {
+	var targets []tcping.Target
+
+	if opts.TargetsFile != "" {
+		fromFile, err := readTargetsFile(opts.TargetsFile, opts.Port)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, fromFile...)
+	}
+
+	if len(args) == 2 && isPortArg(args[1]) {
+		host, port, err := parseTarget(opts, args)
+		if err != nil {
+			return nil, err
+		}
+		return append(targets, tcping.Target{Host: host, Port: port}), nil
+	}
+
+	for _, a := range args {
+		t, err := parseTargetSpec(a, opts.Port)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, t)
+	}
+
+	if len(targets) == 0 {
+		_, _, err := parseTarget(opts, nil)
+		return nil, err
+	}
+	return targets, nil
+}
+
+// isPortArg reports whether s looks like a port ("443" or ":443") rather
+// than another target. Range checking is left to parseTarget.
+func isPortArg(s string) bool {
+	s = strings.TrimPrefix(strings.TrimSpace(s), ":")
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// parseTargetSpec parses "host", "host:port" or "[v6]:port".
+func parseTargetSpec(spec string, defaultPort int) (tcping.Target, error) {
+	h, p := splitHostMaybeWithPort(spec)
+	if h == "" {
+		return tcping.Target{}, fmt.Errorf(msg("err.target"), spec)
+	}
+	if p == "" {
+		p = strconv.Itoa(defaultPort)
+	}
+	portNum, err := strconv.Atoi(p)
+	if err != nil || !isValidPort(portNum) {
+		return tcping.Target{}, fmt.Errorf(msg("err.target_port"), spec)
+	}
+	return tcping.Target{Host: h, Port: p}, nil
+}
+
+// readTargetsFile reads one target per line. Blank lines and "#" comments
+// are ignored; "host port" is accepted as well as "host:port".
+func readTargetsFile(path string, defaultPort int) ([]tcping.Target, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf(msg("err.targets_open"), err)
+	}
+	defer f.Close()
+
+	var targets []tcping.Target
+	sc := bufio.NewScanner(f)
+	lineNo := 0
+	for sc.Scan() {
+		lineNo++
+		line := sc.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		spec := fields[0]
+		if len(fields) >= 2 {
+			spec = net.JoinHostPort(strings.Trim(fields[0], "[]"), strings.TrimPrefix(fields[1], ":"))
+		}
+		t, err := parseTargetSpec(spec, defaultPort)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNo, err)
+		}
+		targets = append(targets, t)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf(msg("err.targets_read"), err)
+	}
+	return targets, nil
+}
+
 func splitHostMaybeWithPort(s string) (host string, port string) {
 	s = strings.TrimSpace(s)
 	if s == "" {
@@ -712,36 +2013,519 @@ func splitHostMaybeWithPort(s string) (host string, port string) {
 }
 
 // =====================
-// Output / helpers
+// Localization
 // =====================
 
-func printHelp() {
-	fmt.Printf(`%s %s - TCP 连接测试工具
+const (
+	langZH = "zh"
+	langEN = "en"
+)
+
+// lang is the output language, chosen once in main before any output.
+var lang = langZH
+
+// messages holds every user-facing string by key. Chinese is the reference
+// catalog; keys missing from another language fall back to it.
+var messages = map[string]map[string]string{
+	langZH: {
+		"help":        helpZH,
+		"version":     "%s 版本 %s\n",
+		"interrupted": "\n操作被中断。\n",
+
+		"intro.with_ip":   "%s正在对 %s [%s - %s] 端口 %s 执行 TCP Ping\n",
+		"intro.plain":     "%s正在对 %s 端口 %s 执行 TCP Ping\n",
+		"intro.mode_rr":   "轮询",
+		"intro.mode_each": "同时探测",
+		"intro.all_ips":   "%s%s %d 个地址: %s\n",
+		"intro.resolved":  "域名 %s 解析到的所有IP地址:\n",
+		"intro.using_ip":  "使用IP地址: %s\n\n",
+		"intro.dns_time":  "%sDNS 解析耗时: %.2fms\n",
+		"intro.source":    "%s源地址: %s\n",
+		"intro.interface": "%s出口网卡: %s\n",
+		"intro.sockopts":  "%s套接字选项: %s\n",
+		"intro.syn":       "%s半开放 SYN 探测: 只发送 SYN, 收到 SYN-ACK 后以 RST 结束, 不建立连接\n",
+
+		"probe.tls_fail":        "%sTLS握手失败 %s:%s: seq=%d connect=%.2fms 类型=%s 错误=%v\n",
+		"probe.tls_fail_detail": "%s  详细信息: 握手耗时 %.2fms, SNI=%s, 目标 %s\n",
+		"probe.http_fail":       "%sHTTP请求失败 %s:%s: seq=%d %s 类型=%s 错误=%v\n",
+		"probe.tcp_fail":        "%sTCP连接失败 %s:%s: seq=%d 类型=%s 错误=%v\n",
+		"probe.syn_open":        "%s从 %s:%s 收到 SYN-ACK: seq=%d time=%.2fms 状态=开放\n",
+		"probe.syn_closed":      "%s从 %s:%s 收到 RST: seq=%d time=%.2fms 状态=关闭\n",
+		"probe.syn_filtered":    "%s%s:%s 无响应: seq=%d 状态=被过滤\n",
+		"probe.tcp_fail_detail": "%s  详细信息: 连接尝试耗时 %.2fms, 目标 %s\n",
+		"probe.reply_http":      "%s从 %s:%s 收到响应: seq=%d status=%d %s\n",
+		"probe.reply_tls":       "%s从 %s:%s 收到响应: seq=%d connect=%.2fms tls=%.2fms\n",
+		"probe.reply":           "%s从 %s:%s 收到响应: seq=%d time=%.2fms\n",
+		"probe.syn_retransmit":  "%s  SYN 经重传后才建立连接, 计为恢复的丢包\n",
+		"probe.reply_detail":    "%s  详细信息: 本地地址=%s, 远程地址=%s\n",
+		"probe.tcpinfo_detail":  "%s  TCP_INFO: srtt=%.2fms, rttvar=%.2fms, 重传=%d, SYN 重传=%d, MSS=%d, PMTU=%d\n",
+		"probe.tls_detail":      "%s  TLS 信息: 版本=%s, 加密套件=%s, ALPN=%s, 证书到期=%s\n",
+
+		"event.reason_interval": "定时",
+		"event.reason_failures": "连续失败",
+		"event.failed":          "%sDNS 重新解析(%s)失败, 继续使用原地址: %s\n",
+		"event.changed":         "%sDNS 重新解析(%s): %s 地址变化 %s -> %s (全部: %s)\n",
+
+		"summary.per_ip":      "\n各地址统计:",
+		"summary.group":       "\n\n--- %d 个目标的 TCP ping 统计 ---\n",
+		"summary.tls":         "TLS 握手: 成功 = %d, 失败 = %d",
+		"summary.tls_rtt":     ", 最小 = %.2fms, 最大 = %.2fms, 平均 = %.2fms, P95 = %.2fms",
+		"summary.http_status": "HTTP 状态码: %s\n",
+		"summary.http_dns":    "DNS 平均 = %.2fms, P95 = %.2fms; ",
+		"summary.http_timing": "HTTP 耗时: %sTTFB 平均 = %.2fms, P95 = %.2fms; 总耗时 平均 = %.2fms, P95 = %.2fms\n",
+		"summary.title":       "\n\n--- 目标 %s 端口 %s 的 TCP ping 统计 ---\n",
+		"summary.counts":      "已发送 = %d, 已接收 = %d, 丢失 = %d (%.1f%% 丢失)\n",
+		"summary.recovered":   "恢复的丢包 (SYN 重传后连接成功) = %d%s\n",
+		"summary.excluded":    ", 未计入 RTT 统计",
+		"summary.failures":    "失败原因: %s\n",
+		"summary.rtt":         "往返时间(RTT): 最小 = %s, 最大 = %s, 平均 = %s\n",
+		"summary.percentiles": "RTT 分位数: 中位数(P50) = %s, P90 = %s, P95 = %s, P99 = %s\n",
+		"summary.spread":      "RTT 离散度: 标准差 = %s, 平均偏差(mdev) = %s\n",
+		"summary.jitter":      "抖动(Jitter): 平均 = %s\n",
+
+		"threshold.no_reply": "没有收到任何响应",
+		"threshold.loss":     "丢失率 %.1f%% > %.1f%%",
+		"threshold.avg":      "平均 RTT %s > %s",
+		"threshold.p95":      "P95 RTT %s > %s",
+		"threshold.success":  "成功次数 %d < %d",
+		"threshold.failed":   "阈值检查失败: %s\n",
+
+		"class." + tcping.ErrClassTimeout:         "连接超时",
+		"class." + tcping.ErrClassRefused:         "连接被拒绝",
+		"class." + tcping.ErrClassHostUnreachable: "主机不可达",
+		"class." + tcping.ErrClassNetUnreachable:  "网络不可达",
+		"class." + tcping.ErrClassReset:           "连接被重置",
+		"class." + tcping.ErrClassDNS:             "DNS 错误",
+		"class." + tcping.ErrClassPermission:      "权限不足",
+		"class." + tcping.ErrClassTLS:             "TLS 握手失败",
+		"class." + tcping.ErrClassHTTPStatus:      "HTTP 状态码异常",
+		"class." + tcping.ErrClassHTTP:            "HTTP 请求失败",
+		"class." + tcping.ErrClassOther:           "其他错误",
+
+		"csv.open":    "无法打开 CSV 文件 %s: %w",
+		"csv.summary": "CSV 记录: %s, 丢弃 %d 行\n",
+		"csv.rotate":  "CSV 轮转失败, 继续写入 %s: %v\n",
+		"csv.reopen":  "CSV 轮转后无法重新打开 %s, 停止记录: %v\n",
+		"csv.gzip":    "压缩 %s 失败: %v\n",
+		"csv.remove":  "删除旧 CSV 文件 %s 失败: %v\n",
+		"csv.close":   "关闭 CSV 文件失败: %v\n",
+		"csv.flush":   "CSV flush 错误: %v\n",
+		"csv.header":  "写入 CSV header 失败: %v\n",
+		"csv.write":   "CSV 写入错误: %v\n",
+
+		"analyze.help":    analyzeHelpZH,
+		"analyze.loaded":  "已读取 %d 条记录 (%d 个文件), 时间范围 %s ~ %s\n",
+		"analyze.buckets": "\n按时间段统计 (每 %s):\n",
+
+		"tui.header":  "%s %s  实时面板  已运行 %s\n",
+		"tui.last":    "  最近: seq=%d %s\n",
+		"tui.counts":  "  已发送 = %d, 已接收 = %d, 丢失 = %d (%.1f%%)\n",
+		"tui.rtt":     "  RTT: 最小 = %.2fms, 平均 = %.2fms, P95 = %.2fms, 最大 = %.2fms, 抖动 = %.2fms\n",
+		"tui.errors":  "最近错误与事件:\n",
+		"tui.quit":    "按 Ctrl+C 结束并显示统计\n",
+		"tui.dropped": "(仪表盘运行期间的消息过多, 已丢弃最早的 %d 条)\n",
+
+		"compare.help":       compareHelpZH,
+		"compare.title":      "\n--- %s [%s] 端口 %s (之前 %d 次, 之后 %d 次) ---\n",
+		"compare.test":       "显著性: RTT p = %s (Mann-Whitney U), 丢失率 p = %s (双比例 z 检验)\n",
+		"compare.only":       "仅出现在 %s 中, 跳过: %s\n",
+		"compare.regression": "退化: %s: %s\n",
+		"compare.loss":       "丢失率增加 %.1f 个百分点 > %.1f",
+		"compare.avg":        "平均 RTT 增加 %.2fms > %.2fms",
+		"compare.p95":        "P95 RTT 增加 %.2fms > %.2fms",
+
+		"tls.cert_expiry": "%s (剩余 %d 天)",
+
+		"err.not_ipv4":            "地址 %s 不是 IPv4 地址",
+		"err.not_ipv6":            "地址 %s 不是 IPv6 地址",
+		"err.dns_server":          "DNS 服务器地址无效: %w",
+		"err.resolve_via":         "通过 DNS 服务器 %s 解析 %s 失败: %w",
+		"err.resolve":             "解析 %s 失败: %w",
+		"err.no_ip":               "未找到 %s 的 IP 地址",
+		"err.no_ipv4":             "未找到 %s 的 IPv4 地址",
+		"err.no_ipv6":             "未找到 %s 的 IPv6 地址",
+		"err.prefix":              "错误: %s%v\n",
+		"err.all_targets_failed":  "所有目标均无法执行 TCP Ping",
+		"err.json_encode":         "JSON 编码错误: %v\n",
+		"err.json_file":           "无法打开 JSON 文件 %s: %w",
+		"err.metrics_listen":      "无法监听指标地址 %s: %w",
+		"err.metrics_serve":       "指标服务错误: %v\n",
+		"err.tls":                 "TLS 握手: ",
+		"err.http":                "HTTP 请求: ",
+		"err.http_status":         "HTTP 状态码 %d 不在预期范围内",
+		"err.status_code":         "状态码无效: %s",
+		"err.status_range":        "状态码范围无效: %s",
+		"err.status_empty":        "预期状态码不能为空",
+		"err.header":              "请求头格式应为 \"名称: 值\": %s",
+		"err.ipv4_ipv6":           "无法同时使用 -4 和 -6 标志",
+		"err.interval":            "间隔时间必须大于 0",
+		"err.timeout":             "超时时间必须大于 0",
+		"err.dns_timeout":         "DNS 超时时间必须大于 0",
+		"err.port":                "端口号必须是 1 到 65535 之间的整数",
+		"err.format":              "不支持的输出格式: %s (可选: text, json)",
+		"err.csv_mode":            "不支持的 CSV 模式: %s (可选: best-effort, lossless)",
+		"err.tui_format":          "--tui 不能与 --format json 同时使用",
+		"err.csv_rotate_size":     "无效的 --csv-rotate-size: %s (示例: 500K, 100M, 1G)",
+		"err.csv_rotate_every":    "--csv-rotate-every 不能为负数",
+		"err.csv_keep":            "--csv-keep 不能为负数",
+		"err.csv_flags":           "--csv-rotate-size/--csv-rotate-every/--csv-keep/--csv-gzip 需要配合 -o 使用",
+		"err.tls_flags":           "--sni、--alpn 和 --insecure 需要配合 --tls 使用",
+		"err.syn_flags":           "--syn 不能与 --tls 或 --http 同时使用",
+		"err.syn_os":              "--syn 仅支持 Linux",
+		"err.syn_perm":            "--syn 需要 root 或 CAP_NET_RAW 权限: %v",
+		"err.http_alpn":           "--alpn 不能与 --http 同时使用 (HTTP 模式固定协商 http/1.1)",
+		"err.http_method":         "HTTP 方法不能为空",
+		"err.http_status_flag":    "--http-status 无效: %w",
+		"err.fail_loss":           "--fail-loss 必须在 0 到 100 之间",
+		"err.fail_rtt":            "--fail-avg 和 --fail-p95 不能为负数",
+		"err.require_success":     "--require-success 不能为负数",
+		"err.re_resolve":          "--re-resolve 不能为负数",
+		"err.re_resolve_failures": "--re-resolve-failures 不能为负数",
+		"err.all_ips":             "不支持的 --all-ips 模式: %s (可选: rr, each)",
+		"err.lang":                "不支持的 --lang: %s (可选: zh, en)",
+		"err.analyze_files":       "需要至少一个 CSV 文件\n\n用法: tcping analyze [选项] <文件.csv>...",
+		"err.analyze_empty":       "没有符合条件的记录",
+		"err.analyze_time":        "无效的 %s 时间: %s (示例: 2026-03-19T06:00:00Z, \"2026-03-19 06:00\")",
+		"err.analyze_range":       "--to 不能早于 --from",
+		"err.analyze_bucket":      "--bucket 必须大于 0",
+		"err.analyze_column":      "%s: 缺少 %s 列, 不是 tcping 生成的 CSV 文件?",
+		"err.analyze_row":         "%s: 第 %d 行的 %s 无效",
+		"err.compare_files":       "需要两个 CSV 文件\n\n用法: tcping compare [选项] <之前.csv> <之后.csv>",
+		"err.compare_none":        "两份记录没有共同的 主机/IP/端口",
+		"err.compare_alpha":       "--alpha 必须在 0 和 1 之间",
+		"err.concurrency":         "并发数不能小于 0",
+		"err.in_flight":           "--in-flight 不能小于 0",
+		"err.duration":            "--duration 不能为负数",
+		"err.deadline":            "无效的 --deadline: %s (需要 RFC3339 格式, 如 2026-03-19T18:00:00+08:00)",
+		"err.deadline_past":       "--deadline %s 已经过去",
+		"err.source":              "无效的 --source: %s (需要 IP 地址或 IP:端口)",
+		"err.source_family":       "--source %s 与 -4/-6 指定的地址族不一致",
+		"err.source_port":         "--source %s 固定了源端口，不能与大于 1 的 --in-flight 或 --all-ips each 同时使用（同一端口不能同时建立多个连接）",
+		"err.source_port_targets": "--source %s 固定了源端口，只能探测一个目标",
+		"err.sockopt_os":          "--interface、--tos、--dscp、--ttl 和 --fwmark 仅支持 Linux",
+		"err.tos_dscp":            "--tos 和 --dscp 不能同时使用",
+		"err.tos":                 "--tos 必须在 0 到 255 之间",
+		"err.dscp":                "--dscp 必须在 0 到 63 之间",
+		"err.ttl":                 "--ttl 必须在 1 到 255 之间",
+		"err.fwmark":              "--fwmark 必须在 0 到 0xffffffff 之间",
+		"err.interface":           "找不到网络接口: %s",
+		"err.dns_host":            "DNS 主机必须是 IP 地址: %s",
+		"err.dns_port":            "DNS 端口号必须是 1 到 65535 之间的整数",
+		"err.no_host":             "需要提供主机参数\n\n用法: tcping [选项] <主机> [端口]\n尝试 'tcping -h' 获取更多信息",
+		"err.target":              "目标无效: %q",
+		"err.target_port":         "目标 %s 的端口号必须是 1 到 65535 之间的整数",
+		"err.targets_open":        "无法打开目标文件: %w",
+		"err.targets_read":        "读取目标文件失败: %w",
+		"err.generic":             "错误: %v\n",
+	},
+	langEN: {
+		"help":        helpEN,
+		"version":     "%s version %s\n",
+		"interrupted": "\nOperation interrupted.\n",
+
+		"intro.with_ip":   "%sTCP pinging %s [%s - %s] port %s\n",
+		"intro.plain":     "%sTCP pinging %s port %s\n",
+		"intro.mode_rr":   "Rotating across",
+		"intro.mode_each": "Probing all of",
+		"intro.all_ips":   "%s%s %d addresses: %s\n",
+		"intro.resolved":  "All IP addresses resolved for %s:\n",
+		"intro.using_ip":  "Using IP address: %s\n\n",
+		"intro.dns_time":  "%sDNS lookup time: %.2fms\n",
+		"intro.source":    "%sSource address: %s\n",
+		"intro.interface": "%sBound to interface: %s\n",
+		"intro.sockopts":  "%sSocket options: %s\n",
+		"intro.syn":       "%sHalf-open SYN probing: a SYN-ACK is answered with RST, no connection is made\n",
+
+		"probe.tls_fail":        "%sTLS handshake failed %s:%s: seq=%d connect=%.2fms class=%s error=%v\n",
+		"probe.tls_fail_detail": "%s  Details: handshake time %.2fms, SNI=%s, target %s\n",
+		"probe.http_fail":       "%sHTTP request failed %s:%s: seq=%d %s class=%s error=%v\n",
+		"probe.tcp_fail":        "%sTCP connection failed %s:%s: seq=%d class=%s error=%v\n",
+		"probe.syn_open":        "%sSYN-ACK from %s:%s: seq=%d time=%.2fms state=open\n",
+		"probe.syn_closed":      "%sRST from %s:%s: seq=%d time=%.2fms state=closed\n",
+		"probe.syn_filtered":    "%sNo answer from %s:%s: seq=%d state=filtered\n",
+		"probe.tcp_fail_detail": "%s  Details: connection attempt took %.2fms, target %s\n",
+		"probe.reply_http":      "%sReply from %s:%s: seq=%d status=%d %s\n",
+		"probe.reply_tls":       "%sReply from %s:%s: seq=%d connect=%.2fms tls=%.2fms\n",
+		"probe.reply":           "%sReply from %s:%s: seq=%d time=%.2fms\n",
+		"probe.syn_retransmit":  "%s  Connected only after a SYN retransmission, counted as recovered loss\n",
+		"probe.reply_detail":    "%s  Details: local address=%s, remote address=%s\n",
+		"probe.tcpinfo_detail":  "%s  TCP_INFO: srtt=%.2fms, rttvar=%.2fms, retrans=%d, SYN retrans=%d, MSS=%d, PMTU=%d\n",
+		"probe.tls_detail":      "%s  TLS: version=%s, cipher=%s, ALPN=%s, cert expiry=%s\n",
+
+		"event.reason_interval": "interval",
+		"event.reason_failures": "failures",
+		"event.failed":          "%sDNS re-resolve (%s) failed, keeping current address: %s\n",
+		"event.changed":         "%sDNS re-resolve (%s): %s address changed %s -> %s (all: %s)\n",
+
+		"summary.per_ip":      "\nPer-address statistics:",
+		"summary.group":       "\n\n--- TCP ping statistics for %d targets ---\n",
+		"summary.tls":         "TLS handshake: succeeded = %d, failed = %d",
+		"summary.tls_rtt":     ", min = %.2fms, max = %.2fms, avg = %.2fms, P95 = %.2fms",
+		"summary.http_status": "HTTP status: %s\n",
+		"summary.http_dns":    "DNS avg = %.2fms, P95 = %.2fms; ",
+		"summary.http_timing": "HTTP timing: %sTTFB avg = %.2fms, P95 = %.2fms; total avg = %.2fms, P95 = %.2fms\n",
+		"summary.title":       "\n\n--- TCP ping statistics for %s port %s ---\n",
+		"summary.counts":      "Sent = %d, Received = %d, Lost = %d (%.1f%% loss)\n",
+		"summary.recovered":   "Recovered loss (connected after a SYN retransmission) = %d%s\n",
+		"summary.excluded":    ", left out of the RTT figures",
+		"summary.failures":    "Failure reasons: %s\n",
+		"summary.rtt":         "Round-trip time (RTT): min = %s, max = %s, avg = %s\n",
+		"summary.percentiles": "RTT percentiles: median (P50) = %s, P90 = %s, P95 = %s, P99 = %s\n",
+		"summary.spread":      "RTT spread: stddev = %s, mean deviation (mdev) = %s\n",
+		"summary.jitter":      "Jitter: avg = %s\n",
+
+		"threshold.no_reply": "no replies received",
+		"threshold.loss":     "loss %.1f%% > %.1f%%",
+		"threshold.avg":      "avg RTT %s > %s",
+		"threshold.p95":      "P95 RTT %s > %s",
+		"threshold.success":  "successes %d < %d",
+		"threshold.failed":   "Threshold check failed: %s\n",
+
+		"class." + tcping.ErrClassTimeout:         "timeout",
+		"class." + tcping.ErrClassRefused:         "connection refused",
+		"class." + tcping.ErrClassHostUnreachable: "host unreachable",
+		"class." + tcping.ErrClassNetUnreachable:  "network unreachable",
+		"class." + tcping.ErrClassReset:           "connection reset",
+		"class." + tcping.ErrClassDNS:             "DNS error",
+		"class." + tcping.ErrClassPermission:      "permission denied",
+		"class." + tcping.ErrClassTLS:             "TLS handshake failed",
+		"class." + tcping.ErrClassHTTPStatus:      "unexpected HTTP status",
+		"class." + tcping.ErrClassHTTP:            "HTTP request failed",
+		"class." + tcping.ErrClassOther:           "other error",
+
+		"csv.open":    "cannot open CSV file %s: %w",
+		"csv.summary": "CSV log: %s, %d rows dropped\n",
+		"csv.rotate":  "CSV rotation failed, still writing to %s: %v\n",
+		"csv.reopen":  "cannot reopen %s after CSV rotation, logging stopped: %v\n",
+		"csv.gzip":    "failed to compress %s: %v\n",
+		"csv.remove":  "failed to remove old CSV file %s: %v\n",
+		"csv.close":   "failed to close CSV file: %v\n",
+		"csv.flush":   "CSV flush error: %v\n",
+		"csv.header":  "failed to write CSV header: %v\n",
+		"csv.write":   "CSV write error: %v\n",
+
+		"analyze.help":    analyzeHelpEN,
+		"analyze.loaded":  "Read %d records (%d files), from %s to %s\n",
+		"analyze.buckets": "\nPer time bucket (every %s):\n",
+
+		"tui.header":  "%s %s  live dashboard  running %s\n",
+		"tui.last":    "  Last: seq=%d %s\n",
+		"tui.counts":  "  Sent = %d, Received = %d, Lost = %d (%.1f%%)\n",
+		"tui.rtt":     "  RTT: min = %.2fms, avg = %.2fms, P95 = %.2fms, max = %.2fms, jitter = %.2fms\n",
+		"tui.errors":  "Recent errors and events:\n",
+		"tui.quit":    "Press Ctrl+C to stop and show statistics\n",
+		"tui.dropped": "(too many messages while the dashboard was shown; the oldest %d were dropped)\n",
+
+		"compare.help":       compareHelpEN,
+		"compare.title":      "\n--- %s [%s] port %s (%d probes before, %d after) ---\n",
+		"compare.test":       "Significance: RTT p = %s (Mann-Whitney U), loss p = %s (two-proportion z test)\n",
+		"compare.only":       "only in %s, skipped: %s\n",
+		"compare.regression": "Regression: %s: %s\n",
+		"compare.loss":       "loss up %.1f points > %.1f",
+		"compare.avg":        "avg RTT up %.2fms > %.2fms",
+		"compare.p95":        "P95 RTT up %.2fms > %.2fms",
+
+		"tls.cert_expiry": "%s (%d days left)",
+
+		"err.not_ipv4":            "address %s is not an IPv4 address",
+		"err.not_ipv6":            "address %s is not an IPv6 address",
+		"err.dns_server":          "invalid DNS server address: %w",
+		"err.resolve_via":         "DNS server %s failed to resolve %s: %w",
+		"err.resolve":             "failed to resolve %s: %w",
+		"err.no_ip":               "no IP address found for %s",
+		"err.no_ipv4":             "no IPv4 address found for %s",
+		"err.no_ipv6":             "no IPv6 address found for %s",
+		"err.prefix":              "Error: %s%v\n",
+		"err.all_targets_failed":  "no target could be TCP pinged",
+		"err.json_encode":         "JSON encoding error: %v\n",
+		"err.json_file":           "cannot open JSON file %s: %w",
+		"err.metrics_listen":      "cannot listen on metrics address %s: %w",
+		"err.metrics_serve":       "metrics server error: %v\n",
+		"err.tls":                 "TLS handshake: ",
+		"err.http":                "HTTP request: ",
+		"err.http_status":         "HTTP status %d is not in the expected range",
+		"err.status_code":         "invalid status code: %s",
+		"err.status_range":        "invalid status range: %s",
+		"err.status_empty":        "expected status codes must not be empty",
+		"err.header":              "header must be in the form \"Name: value\": %s",
+		"err.ipv4_ipv6":           "-4 and -6 cannot be used together",
+		"err.interval":            "interval must be greater than 0",
+		"err.timeout":             "timeout must be greater than 0",
+		"err.dns_timeout":         "DNS timeout must be greater than 0",
+		"err.port":                "port must be an integer between 1 and 65535",
+		"err.format":              "unsupported output format: %s (choices: text, json)",
+		"err.csv_mode":            "unsupported CSV mode: %s (choices: best-effort, lossless)",
+		"err.tui_format":          "--tui cannot be combined with --format json",
+		"err.csv_rotate_size":     "invalid --csv-rotate-size: %s (e.g. 500K, 100M, 1G)",
+		"err.csv_rotate_every":    "--csv-rotate-every must not be negative",
+		"err.csv_keep":            "--csv-keep must not be negative",
+		"err.csv_flags":           "--csv-rotate-size/--csv-rotate-every/--csv-keep/--csv-gzip require -o",
+		"err.tls_flags":           "--sni, --alpn and --insecure require --tls",
+		"err.syn_flags":           "--syn cannot be combined with --tls or --http",
+		"err.syn_os":              "--syn is only supported on Linux",
+		"err.syn_perm":            "--syn needs root or CAP_NET_RAW: %v",
+		"err.http_alpn":           "--alpn cannot be combined with --http (HTTP mode always negotiates http/1.1)",
+		"err.http_method":         "HTTP method must not be empty",
+		"err.http_status_flag":    "invalid --http-status: %w",
+		"err.fail_loss":           "--fail-loss must be between 0 and 100",
+		"err.fail_rtt":            "--fail-avg and --fail-p95 must not be negative",
+		"err.require_success":     "--require-success must not be negative",
+		"err.re_resolve":          "--re-resolve must not be negative",
+		"err.re_resolve_failures": "--re-resolve-failures must not be negative",
+		"err.all_ips":             "unsupported --all-ips mode: %s (choices: rr, each)",
+		"err.lang":                "unsupported --lang: %s (choices: zh, en)",
+		"err.analyze_files":       "at least one CSV file is required\n\nUsage: tcping analyze [options] <file.csv>...",
+		"err.analyze_empty":       "no matching records",
+		"err.analyze_time":        "invalid %s time: %s (e.g. 2026-03-19T06:00:00Z, \"2026-03-19 06:00\")",
+		"err.analyze_range":       "--to must not be before --from",
+		"err.analyze_bucket":      "--bucket must be greater than 0",
+		"err.analyze_column":      "%s: missing %s column, not a CSV file written by tcping?",
+		"err.analyze_row":         "%[1]s: invalid %[3]s on line %[2]d",
+		"err.compare_files":       "two CSV files are required\n\nUsage: tcping compare [options] <before.csv> <after.csv>",
+		"err.compare_none":        "the two logs have no host/IP/port in common",
+		"err.compare_alpha":       "--alpha must be between 0 and 1",
+		"err.concurrency":         "concurrency must not be negative",
+		"err.in_flight":           "--in-flight must not be negative",
+		"err.duration":            "--duration must not be negative",
+		"err.deadline":            "invalid --deadline: %s (RFC3339 expected, e.g. 2026-03-19T18:00:00+08:00)",
+		"err.deadline_past":       "--deadline %s is in the past",
+		"err.source":              "invalid --source: %s (IP address or IP:port expected)",
+		"err.source_family":       "--source %s does not match the address family chosen with -4/-6",
+		"err.source_port":         "--source %s fixes the source port and cannot be combined with --in-flight above 1 or --all-ips each (one port cannot hold several connections at once)",
+		"err.source_port_targets": "--source %s fixes the source port, so only one target can be probed",
+		"err.sockopt_os":          "--interface, --tos, --dscp, --ttl and --fwmark are only supported on Linux",
+		"err.tos_dscp":            "--tos and --dscp cannot be used together",
+		"err.tos":                 "--tos must be between 0 and 255",
+		"err.dscp":                "--dscp must be between 0 and 63",
+		"err.ttl":                 "--ttl must be between 1 and 255",
+		"err.fwmark":              "--fwmark must be between 0 and 0xffffffff",
+		"err.interface":           "no such network interface: %s",
+		"err.dns_host":            "DNS host must be an IP address: %s",
+		"err.dns_port":            "DNS port must be an integer between 1 and 65535",
+		"err.no_host":             "a host argument is required\n\nUsage: tcping [options] <host> [port]\nTry 'tcping -h' for more information",
+		"err.target":              "invalid target: %q",
+		"err.target_port":         "port of target %s must be an integer between 1 and 65535",
+		"err.targets_open":        "cannot open targets file: %w",
+		"err.targets_read":        "failed to read targets file: %w",
+		"err.generic":             "Error: %v\n",
+	},
+}
+
+// msg returns the message for key in the current language.
+func msg(key string) string {
+	if s, ok := messages[lang][key]; ok {
+		return s
+	}
+	if s, ok := messages[langZH][key]; ok {
+		return s
+	}
+	return key
+}
+
+// detectLang picks the output language from --lang, falling back to the
+// usual locale variables. Unknown or unset locales keep the Chinese output.
+func detectLang(flagValue string) (string, error) {
+	if flagValue != "" {
+		if l := matchLang(flagValue); l != "" {
+			return l, nil
+		}
+		return lang, fmt.Errorf(msg("err.lang"), flagValue)
+	}
+	for _, env := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if v := os.Getenv(env); v != "" {
+			if l := matchLang(v); l != "" {
+				return l, nil
+			}
+			return langZH, nil
+		}
+	}
+	return langZH, nil
+}
+
+// matchLang maps a language tag or locale such as "en_US.UTF-8" to a
+// catalog name.
+func matchLang(v string) string {
+	v = strings.ToLower(v)
+	for _, l := range []string{langZH, langEN} {
+		if v == l || strings.HasPrefix(v, l+"_") || strings.HasPrefix(v, l+"-") || strings.HasPrefix(v, l+".") {
+			return l
+		}
+	}
+	return ""
+}
+
+const helpZH = `%s %s - TCP 连接测试工具
 
 描述:
     %s 测试到目标主机和端口的TCP连接性。
 
 用法:
     tcping [选项] <主机> [端口]      (默认端口: 80)
+    tcping [选项] <主机[:端口]> <主机[:端口]>...
+    tcping analyze [选项] <文件.csv>...    (离线分析 CSV 记录, 详见 tcping analyze -h)
+    tcping compare [选项] <之前.csv> <之后.csv>  (比较两次运行, 详见 tcping compare -h)
 
 选项:
     -4, --ipv4                  强制使用 IPv4
     -6, --ipv6                  强制使用 IPv6
     -n, --count <次数>          发送请求次数 (默认: 无限)
+        --duration <时长>       运行该时长后结束并输出统计 (如: 5m, 1h)
+        --deadline <时间>       到达该时间后结束并输出统计 (RFC3339, 如: 2026-03-19T18:00:00+08:00)
     -p, --port <端口>           指定要连接的端口 (默认: 80)
     -t, --interval <毫秒>       请求间隔 (默认: 1000)
     -w, --timeout <毫秒>        连接超时 (默认: 1000)
         --dns-timeout <毫秒>    DNS 解析超时 (默认: 1500)
 	    --dns-server <地址>     指定 DNS 服务器 (如: 8.8.8.8 或 8.8.8.8:53)
+        --re-resolve <时长>     每隔该时长重新解析域名 (如: 30s, 5m)
+        --re-resolve-failures <N>  连续失败 N 次后重新解析域名
+        --source <IP[:端口]>    从指定的本地地址发起连接 (同时决定地址族)
+        --interface <网卡>      绑定到指定网卡发送 (SO_BINDTODEVICE, 仅 Linux)
+        --tos <值>              IPv4 TOS / IPv6 Traffic Class (0-255, 如: 0xb8, 仅 Linux)
+        --dscp <值>             DSCP 值 (0-63, 如: 46 即 EF), 与 --tos 二选一
+        --ttl <跳数>            IPv4 TTL / IPv6 跳数限制 (1-255, 仅 Linux)
+        --fwmark <值>           为探测设置 SO_MARK, 用于策略路由 (如: 0x10, 仅 Linux, 需要 root)
+        --all-ips <rr|each>     探测所有解析到的地址: rr 每次轮换, each 每次全部探测
+        --targets-file <文件>   从文件读取目标列表 (每行一个 主机[:端口])
+        --concurrency <N>       多目标时同时进行的探测数上限 (默认: 0 不限制)
+        --in-flight <N>         固定速率发送, 不等待慢探测, 每个目标最多 N 个同时进行 (默认: 0 逐个等待)
+        --exclude-recovered     SYN 重传后才成功的探测不计入 RTT 统计 (仍计为已接收)
+        --metrics-listen <地址> 在该地址提供 Prometheus /metrics (如: :9115)
+        --syn                   半开放 SYN 探测, 不建立完整连接, 报告 开放/关闭/被过滤 (仅 Linux, 需要 root)
+        --tls                   连接后执行 TLS 握手并分别统计握手耗时
+        --sni <名称>            TLS SNI 名称 (默认: 目标主机)
+        --alpn <协议>           TLS ALPN 协议列表, 逗号分隔 (如: h2,http/1.1), 不能与 --http 同用
+        --insecure              不校验服务器证书
+        --http                  连接后发送 HTTP 请求 (配合 --tls 即为 HTTPS)
+        --http-method <方法>    HTTP 请求方法 (默认: GET)
+        --http-path <路径>      HTTP 请求路径 (默认: /)
+        --http-host <主机>      HTTP Host 请求头 (默认: 目标主机)
+    -H, --header <名称: 值>     附加请求头, 可重复指定
+        --http-status <范围>    视为成功的状态码 (默认: 200-399)
     -c, --color                 启用彩色输出
     -v, --verbose               启用详细模式
 	-D, --timestamp             显示时间戳 (yyyy-mm-dd hh:mm:ss)
+        --format <text|json>    输出格式, json 为每行一个 JSON 对象 (默认: text)
+        --json-file <路径>      同时将 JSON 记录追加写入文件, 可与 -o 同时使用
+        --tui                   全屏实时面板 (RTT 走势、丢失时间线、最近错误), 非终端时退回普通输出
     -o, --csv                   在当前目录生成 CSV 文件记录
+        --csv-mode <模式>       best-effort 在写入跟不上时丢弃行, lossless 阻塞探测保证不丢 (默认: best-effort)
         --csv-flush-every <N>   每 N 行 flush 一次 (默认: 50)
         --csv-flush-tick <毫秒> 定时 flush (默认: 1000)
+        --csv-rotate-size <大小>  文件达到该大小时轮转 (如: 100M)
+        --csv-rotate-every <时长> 按固定周期轮转, 对齐到整点 (如: 1h, 24h)
+        --csv-keep <N>          只保留最近 N 个已轮转文件 (默认: 全部保留)
+        --csv-gzip              用 gzip 压缩已轮转文件
+        --fail-loss <百分比>    丢失率超过该值时以退出码 4 结束
+        --fail-avg <毫秒>       平均 RTT 超过该值时以退出码 4 结束
+        --fail-p95 <毫秒>       P95 RTT 超过该值时以退出码 4 结束
+        --require-success <N>   成功次数少于 N 时以退出码 4 结束
+        --lang <zh|en>          输出语言 (默认: 按 LC_ALL/LC_MESSAGES/LANG, 否则 zh)
     -V, --version               显示版本信息
     -h, --help                  显示帮助信息
 
+退出码:
+    0 成功, 1 运行错误 (如解析失败), 2 参数错误, 3 目标无响应, 4 超过阈值
+
 示例:
     tcping google.com
     tcping google.com 443
@@ -750,32 +2534,154 @@ func printHelp() {
     tcping -4 -n 5 8.8.8.8 443
     tcping -w 2000 example.com 22
 	tcping --dns-server 1.1.1.1 github.com 443
+    tcping -n 10 google.com:443 github.com:443 1.1.1.1:53
+    tcping --all-ips each -n 5 cdn.example.com 443
+    tcping --re-resolve 1m --re-resolve-failures 3 service.example.com 443
+    tcping --targets-file edges.txt --concurrency 10
+    tcping --metrics-listen :9115 --targets-file edges.txt
+    tcping --tls --alpn h2 -v example.com 443
+    tcping --http --tls --http-path /healthz -H "X-Probe: 1" example.com 443
+    tcping -c -v example.com 443
+    tcping --format json -n 5 example.com 443
+    tcping -n 10 --fail-loss 20 --fail-p95 200 example.com 443
+    tcping --lang en example.com 443
+
+`
+
+const helpEN = `%s %s - TCP connectivity testing tool
+
+Description:
+    %s tests TCP connectivity to a target host and port.
+
+Usage:
+    tcping [options] <host> [port]      (default port: 80)
+    tcping [options] <host[:port]> <host[:port]>...
+    tcping analyze [options] <file.csv>...  (offline analysis of CSV logs, see tcping analyze -h)
+    tcping compare [options] <before.csv> <after.csv>  (compare two runs, see tcping compare -h)
+
+Options:
+    -4, --ipv4                  Force IPv4
+    -6, --ipv6                  Force IPv6
+    -n, --count <count>         Number of probes to send (default: unlimited)
+        --duration <dur>        Stop and print statistics after this long (e.g. 5m, 1h)
+        --deadline <time>       Stop and print statistics at this time (RFC3339, e.g. 2026-03-19T18:00:00+08:00)
+    -p, --port <port>           Port to connect to (default: 80)
+    -t, --interval <ms>         Interval between probes (default: 1000)
+    -w, --timeout <ms>          Connect timeout (default: 1000)
+        --dns-timeout <ms>      DNS lookup timeout (default: 1500)
+        --dns-server <addr>     DNS server to use (e.g. 8.8.8.8 or 8.8.8.8:53)
+        --re-resolve <dur>      Re-resolve the host at this interval (e.g. 30s, 5m)
+        --re-resolve-failures <N>  Re-resolve the host after N consecutive failures
+        --source <ip[:port]>    Connect from this local address (also picks the address family)
+        --interface <name>      Send through this network interface (SO_BINDTODEVICE, Linux only)
+        --tos <value>           IPv4 TOS / IPv6 traffic class (0-255, e.g. 0xb8, Linux only)
+        --dscp <value>          DSCP value (0-63, e.g. 46 for EF), instead of --tos
+        --ttl <hops>            IPv4 TTL / IPv6 hop limit (1-255, Linux only)
+        --fwmark <value>        Set SO_MARK on probes for policy routing (e.g. 0x10, Linux only, needs root)
+        --all-ips <rr|each>     Probe every resolved address: rr rotates, each probes all every tick
+        --targets-file <file>   Read targets from a file (one host[:port] per line)
+        --concurrency <N>       Max probes in flight across targets (default: 0, unlimited)
+        --in-flight <N>         Send at a fixed rate without waiting for slow probes, up to N in flight per target (default: 0, one at a time)
+        --exclude-recovered     Leave probes that needed a SYN retransmission out of the RTT figures (still received)
+        --metrics-listen <addr> Serve Prometheus /metrics on this address (e.g. :9115)
+        --syn                   Half-open SYN probing without a full connect, reporting open/closed/filtered (Linux only, needs root)
+        --tls                   Perform a TLS handshake after connecting and time it separately
+        --sni <name>            TLS SNI name (default: target host)
+        --alpn <protos>         Comma-separated TLS ALPN protocols (e.g. h2,http/1.1); not with --http
+        --insecure              Skip server certificate verification
+        --http                  Send an HTTP request after connecting (HTTPS with --tls)
+        --http-method <method>  HTTP request method (default: GET)
+        --http-path <path>      HTTP request path (default: /)
+        --http-host <host>      HTTP Host header (default: target host)
+    -H, --header <Name: value>  Extra request header, may be repeated
+        --http-status <ranges>  Status codes counted as success (default: 200-399)
+    -c, --color                 Enable colored output
+    -v, --verbose               Enable verbose mode
+    -D, --timestamp             Show timestamps (yyyy-mm-dd hh:mm:ss)
+        --format <text|json>    Output format, json prints one JSON object per line (default: text)
+        --json-file <path>      Also append the JSON records to a file, combinable with -o
+        --tui                   Full-screen live dashboard (RTT sparkline, loss timeline, recent errors); plain output when stdout is not a terminal
+    -o, --csv                   Write a CSV log to the current directory
+        --csv-mode <mode>       best-effort drops rows when the writer falls behind, lossless blocks probes instead (default: best-effort)
+        --csv-flush-every <N>   Flush every N rows (default: 50)
+        --csv-flush-tick <ms>   Periodic flush interval (default: 1000)
+        --csv-rotate-size <size>  Rotate when the file reaches this size (e.g. 100M)
+        --csv-rotate-every <dur>  Rotate on a fixed period aligned to the clock (e.g. 1h, 24h)
+        --csv-keep <N>          Keep only the newest N rotated files (default: all)
+        --csv-gzip              Compress rotated files with gzip
+        --fail-loss <percent>   Exit with code 4 when loss exceeds this value
+        --fail-avg <ms>         Exit with code 4 when the average RTT exceeds this value
+        --fail-p95 <ms>         Exit with code 4 when the P95 RTT exceeds this value
+        --require-success <N>   Exit with code 4 when fewer than N probes succeed
+        --lang <zh|en>          Output language (default: from LC_ALL/LC_MESSAGES/LANG, else zh)
+    -V, --version               Show version information
+    -h, --help                  Show this help
+
+Exit codes:
+    0 success, 1 runtime error (e.g. resolve failure), 2 usage error, 3 target unreachable, 4 threshold exceeded
+
+Examples:
+    tcping google.com
+    tcping google.com 443
+    tcping google.com:443
+    tcping -p 443 google.com
+    tcping -4 -n 5 8.8.8.8 443
+    tcping -w 2000 example.com 22
+    tcping --dns-server 1.1.1.1 github.com 443
+    tcping -n 10 google.com:443 github.com:443 1.1.1.1:53
+    tcping --all-ips each -n 5 cdn.example.com 443
+    tcping --re-resolve 1m --re-resolve-failures 3 service.example.com 443
+    tcping --targets-file edges.txt --concurrency 10
+    tcping --metrics-listen :9115 --targets-file edges.txt
+    tcping --tls --alpn h2 -v example.com 443
+    tcping --http --tls --http-path /healthz -H "X-Probe: 1" example.com 443
     tcping -c -v example.com 443
+    tcping --format json -n 5 example.com 443
+    tcping -n 10 --fail-loss 20 --fail-p95 200 example.com 443
+    tcping --lang en example.com 443
 
-`, programName, version, programName)
+`
+
+// =====================
+// Output / helpers
+// =====================
+
+func printHelp() {
+	fmt.Printf(msg("help"), programName, version, programName)
 }
 
 func printVersion() {
-	fmt.Printf("%s 版本 %s\n", programName, version)
+	fmt.Printf(msg("version"), programName, version)
 	fmt.Println(copyright)
 }
 
-func printSummary(stats *Statistics, verbose bool, displayHost, port string) {
-	s := stats.Snapshot()
-
-	fmt.Printf("\n\n--- 目标 %s 端口 %s 的 TCP ping 统计 ---\n", displayHost, port)
+func printSummary(s tcping.StatsSnapshot, verbose bool, displayHost, port string) {
+	fmt.Printf(msg("summary.title"), displayHost, port)
 	if s.Sent == 0 {
 		return
 	}
 
 	lossRate := float64(s.Sent-s.Received) / float64(s.Sent) * 100
-	fmt.Printf("已发送 = %d, 已接收 = %d, 丢失 = %d (%.1f%% 丢失)\n", s.Sent, s.Received, s.Sent-s.Received, lossRate)
+	fmt.Printf(msg("summary.counts"), s.Sent, s.Received, s.Sent-s.Received, lossRate)
+	if s.Recovered > 0 {
+		excluded := ""
+		if s.RTTCount < s.Received {
+			excluded = msg("summary.excluded")
+		}
+		fmt.Printf(msg("summary.recovered"), s.Recovered, excluded)
+	}
+	if len(s.Failures) > 0 {
+		fmt.Printf(msg("summary.failures"), formatFailures(s.Failures))
+	}
 
-	if s.Received > 0 {
-		fmt.Printf("往返时间(RTT): 最小 = %.2fms, 最大 = %.2fms, 平均 = %.2fms\n",
-			durMS(s.Min), durMS(s.Max), durMS(s.Avg))
+	if s.RTTCount > 0 {
+		fmt.Printf(msg("summary.rtt"),
+			formatMS(s.Min), formatMS(s.Max), formatMS(s.Avg))
+		fmt.Printf(msg("summary.percentiles"),
+			formatMS(s.P50), formatMS(s.P90), formatMS(s.P95), formatMS(s.P99))
+		fmt.Printf(msg("summary.spread"), formatMS(s.StdDev), formatMS(s.MDev))
 		if verbose {
-			fmt.Printf("抖动(Jitter): 平均 = %.2fms\n", durMS(s.JitterAvg))
+			fmt.Printf(msg("summary.jitter"), formatMS(s.JitterAvg))
 		}
 	}
 }
@@ -812,23 +2718,128 @@ func sanitizeFilename(s string) string {
 	return "unknown"
 }
 
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 func durMS(d time.Duration) float64 {
 	return float64(d.Microseconds()) / 1000.0
 }
 
+// formatMS renders a duration of the summary and the threshold checks:
+// two decimals, with as many digits as needed below 0.01ms so that small
+// values such as loopback RTTs never read 0.00ms.
+func formatMS(d time.Duration) string {
+	if d > 0 && d < 10*time.Microsecond {
+		return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', -1, 64) + "ms"
+	}
+	return fmt.Sprintf("%.2fms", durMS(d))
+}
+
 func formatDisplayTimestamp(t time.Time) string {
 	// Format required: yyyy-mm-dd hh:mm:ss
 	return t.Format("2006-01-02 15:04:05")
 }
 
+// =====================
+// Thresholds / exit codes
+// =====================
+
+// checkThresholds evaluates the final stats of every target and returns
+// the exit code plus a reason per violation. Unreachable wins over degraded.
+func checkThresholds(opts *Options, runners []*tcping.Runner) (int, []string) {
+	code := exitOK
+	var reasons []string
+	for _, r := range runners {
+		s := r.Stats()
+		label := ""
+		if len(runners) > 1 {
+			label = r.Target() + ": "
+		}
+
+		if s.Received == 0 {
+			code = exitUnreachable
+			reasons = append(reasons, label+msg("threshold.no_reply"))
+			continue
+		}
+
+		var degraded []string
+		lossRate := float64(s.Sent-s.Received) / float64(s.Sent) * 100
+		if !math.IsNaN(opts.FailLoss) && lossRate > opts.FailLoss {
+			degraded = append(degraded, fmt.Sprintf(msg("threshold.loss"), lossRate, opts.FailLoss))
+		}
+		if opts.FailAvg > 0 && s.Avg > opts.FailAvg {
+			degraded = append(degraded, fmt.Sprintf(msg("threshold.avg"), formatMS(s.Avg), formatMS(opts.FailAvg)))
+		}
+		if opts.FailP95 > 0 && s.P95 > opts.FailP95 {
+			degraded = append(degraded, fmt.Sprintf(msg("threshold.p95"), formatMS(s.P95), formatMS(opts.FailP95)))
+		}
+		if opts.RequireSuccess > 0 && s.Received < opts.RequireSuccess {
+			degraded = append(degraded, fmt.Sprintf(msg("threshold.success"), s.Received, opts.RequireSuccess))
+		}
+		if len(degraded) > 0 {
+			if code == exitOK {
+				code = exitDegraded
+			}
+			reasons = append(reasons, label+strings.Join(degraded, ", "))
+		}
+	}
+	return code, reasons
+}
+
+// runDeadline combines --duration and --deadline into the earlier of the
+// two; ok is false when neither is set.
+func runDeadline(opts *Options, now time.Time) (end time.Time, ok bool) {
+	if opts.Duration > 0 {
+		end = now.Add(opts.Duration)
+	}
+	if opts.Deadline != "" {
+		if d, err := time.Parse(time.RFC3339, opts.Deadline); err == nil && (end.IsZero() || d.Before(end)) {
+			end = d
+		}
+	}
+	return end, !end.IsZero()
+}
+
 // =====================
 // main
 // =====================
 
 func main() {
+	// The locale applies to flag errors; --lang takes over once parsed.
+	lang, _ = detectLang("")
+
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "analyze":
+			os.Exit(runAnalyze(os.Args[2:]))
+		case "compare":
+			os.Exit(runCompare(os.Args[2:]))
+		}
+	}
+
 	opts := &Options{}
 	setupFlags(opts)
 
+	l, err := detectLang(opts.Lang)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, msg("err.generic"), err)
+		os.Exit(exitUsage)
+	}
+	lang = l
+
 	if opts.ShowHelp {
 		printHelp()
 		os.Exit(0)
@@ -840,48 +2851,102 @@ func main() {
 
 	applyDefaults(opts)
 	if err := validateOptions(opts); err != nil {
-		fmt.Fprintf(os.Stderr, "错误: %v\n", err)
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, msg("err.generic"), err)
+		os.Exit(exitUsage)
 	}
 
-	host, port, err := parseTarget(opts, flag.Args())
+	targets, err := parseTargets(opts, flag.Args())
+	if err == nil {
+		err = validateTargets(opts, targets)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, msg("err.generic"), err)
+		os.Exit(exitUsage)
+	}
+
+	multi := len(targets) > 1
+	out, err := newReporters(opts, targets)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "错误: %v\n", err)
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, msg("err.generic"), err)
+		os.Exit(exitError)
+	}
+	cfg := probeConfig(opts, out, multi)
+
+	var (
+		run     func(ctx context.Context) error
+		runners []*tcping.Runner
+	)
+	if len(targets) == 1 {
+		single := tcping.NewRunner(cfg, targets[0].Host, targets[0].Port)
+		run = func(ctx context.Context) error {
+			_, err := single.Run(ctx)
+			return err
+		}
+		runners = []*tcping.Runner{single}
+	} else {
+		g := tcping.NewGroup(cfg, targets)
+		run, runners = g.Run, g.Runners()
 	}
 
-	r := NewRunner(opts, host, port)
+	if opts.MetricsListen != "" {
+		if err := startMetricsServer(opts.MetricsListen, runners); err != nil {
+			fmt.Fprintf(os.Stderr, msg("err.generic"), err)
+			os.Exit(exitError)
+		}
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
+	// Cancel rather than attach a deadline: a context deadline would be
+	// inherited by in-flight dials and reported as timeouts.
+	if end, ok := runDeadline(opts, time.Now()); ok {
+		stopTimer := time.AfterFunc(time.Until(end), cancel)
+		defer stopTimer.Stop()
+	}
 
 	interrupt := make(chan os.Signal, 1)
 	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
 	defer signal.Stop(interrupt)
 
 	done := make(chan error, 1)
-	go func() { done <- r.Run(ctx) }()
+	go func() { done <- run(ctx) }()
 
 	var runErr error
 	select {
 	case <-interrupt:
-		fmt.Printf("\n操作被中断。\n")
+		if opts.Format != formatJSON {
+			fmt.Fprint(console.writer(os.Stdout), msg("interrupted"))
+		}
 		cancel()
 		runErr = <-done
 	case runErr = <-done:
-		if runErr != nil && !errors.Is(runErr, context.Canceled) {
-			fmt.Fprintf(os.Stderr, "错误: %v\n", runErr)
-		}
+	}
+	// Ctrl+C, --duration and --deadline all end the run through ctx.
+	stopped := runErr != nil && ctx.Err() != nil
+	if runErr != nil && !stopped {
+		fmt.Fprintf(stderr, msg("err.generic"), localizeError(runErr))
 	}
 
 	// Print summary only when it is meaningful:
 	// - normal completion
-	// - cancellation with at least one attempt sent
-	if runErr == nil || (errors.Is(runErr, context.Canceled) && r.SentCount() > 0) {
-		r.PrintSummary()
+	// - stopped with at least one attempt sent
+	summarized := runErr == nil || (stopped && sentCount(runners) > 0)
+	if summarized {
+		out.OnSummary(runners)
 	}
+	out.Close()
 
-	if runErr != nil && !errors.Is(runErr, context.Canceled) {
-		os.Exit(1)
+	if runErr != nil && !stopped {
+		os.Exit(exitError)
+	}
+
+	if summarized {
+		code, reasons := checkThresholds(opts, runners)
+		for _, reason := range reasons {
+			fmt.Fprintf(os.Stderr, msg("threshold.failed"), reason)
+		}
+		if code != exitOK {
+			os.Exit(code)
+		}
 	}
 }
@@ -0,0 +1,5 @@
+//go:build !linux
+
+package main
+
+func ttySize() (cols, rows int, ok bool) { return 0, 0, false }
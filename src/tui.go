@@ -0,0 +1,385 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nodeseeker/tcping"
+)
+
+// =====================
+// Live dashboard (--tui)
+// =====================
+
+const (
+	tuiRefresh     = 250 * time.Millisecond
+	tuiWindow      = 60 // probes kept per target for the sparkline and timeline
+	tuiRecentErrs  = 8  // lines in the errors and events pane
+	tuiDefaultCols = 80
+	tuiDefaultRows = 24
+
+	heldMax = 1000 // messages held while the dashboard is shown
+)
+
+var sparkLevels = []rune("▁▂▃▄▅▆▇█")
+
+// tuiReporter redraws a full-screen view from the result stream. The final
+// summary is left to the text reporter once the screen is restored.
+type tuiReporter struct {
+	opts *Options
+	text *textReporter
+
+	mu      sync.Mutex
+	started time.Time
+	targets []*tuiTarget
+	byRun   map[*tcping.Runner]*tuiTarget
+	errs    []tuiEvent // most recent last
+
+	startOnce sync.Once
+	closeOnce sync.Once
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+type tuiTarget struct {
+	r      *tcping.Runner
+	recent []tuiSample // last tuiWindow probes, oldest first
+	last   tcping.Result
+}
+
+type tuiSample struct {
+	rtt time.Duration
+	ok  bool
+}
+
+// tuiEvent is a failed probe (seq and class) or a re-resolution event
+// (text) in the errors and events pane.
+type tuiEvent struct {
+	at     time.Time
+	target string
+	seq    int
+	class  string
+	text   string
+}
+
+func newTUIReporter(opts *Options, text *textReporter) *tuiReporter {
+	return &tuiReporter{
+		opts:  opts,
+		text:  text,
+		byRun: make(map[*tcping.Runner]*tuiTarget),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+}
+
+// isTerminal reports whether f is a character device such as a terminal,
+// as opposed to a pipe or a file.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+func (t *tuiReporter) OnStart(r *tcping.Runner) {
+	t.mu.Lock()
+	t.targets = append(t.targets, &tuiTarget{r: r})
+	t.byRun[r] = t.targets[len(t.targets)-1]
+	sort.Slice(t.targets, func(i, j int) bool { return t.targets[i].r.Target() < t.targets[j].r.Target() })
+	t.mu.Unlock()
+
+	t.startOnce.Do(func() {
+		t.mu.Lock()
+		t.started = time.Now()
+		t.mu.Unlock()
+		// Alternate screen and hidden cursor until the summary is printed.
+		// Messages for stderr would be wiped with the screen, so they are
+		// held until Close.
+		console.hold()
+		fmt.Print("\033[?1049h\033[?25l")
+		go t.loop()
+	})
+}
+
+func (t *tuiReporter) OnResult(r *tcping.Runner, res tcping.Result) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tt := t.byRun[r]
+	if tt == nil {
+		return
+	}
+	tt.last = res
+	tt.recent = append(tt.recent, tuiSample{rtt: res.RTT, ok: res.Success()})
+	if len(tt.recent) > tuiWindow {
+		tt.recent = tt.recent[len(tt.recent)-tuiWindow:]
+	}
+	if res.Err != nil {
+		t.addEvent(tuiEvent{at: res.Time, target: r.Target(), seq: res.Seq, class: tcping.ClassifyError(res.Err)})
+	}
+}
+
+func (t *tuiReporter) OnResolve(r *tcping.Runner, ev tcping.ResolveEvent) {
+	var text string
+	if ev.Err != nil {
+		text = fmt.Sprintf(msg("event.failed"), "", resolveReason(ev), localizeError(ev.Err))
+	} else {
+		text = fmt.Sprintf(msg("event.changed"), "", resolveReason(ev), r.Host(), ev.OldIP, ev.NewIP, strings.Join(ev.IPs, ", "))
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.addEvent(tuiEvent{at: ev.Time, target: r.Target(), text: strings.TrimSuffix(text, "\n")})
+}
+
+// addEvent keeps the last tuiRecentErrs events. Caller holds t.mu.
+func (t *tuiReporter) addEvent(ev tuiEvent) {
+	t.errs = append(t.errs, ev)
+	if len(t.errs) > tuiRecentErrs {
+		t.errs = t.errs[len(t.errs)-tuiRecentErrs:]
+	}
+}
+
+func (t *tuiReporter) OnSummary(runners []*tcping.Runner) {
+	_ = t.Close()
+	t.text.OnSummary(runners)
+}
+
+// Close restores the terminal; it is safe to call more than once.
+func (t *tuiReporter) Close() error {
+	t.closeOnce.Do(func() {
+		close(t.stop)
+		t.mu.Lock()
+		active := !t.started.IsZero()
+		t.mu.Unlock()
+		if active {
+			<-t.done
+			fmt.Print("\033[?25h\033[?1049l")
+			console.release()
+		}
+	})
+	return nil
+}
+
+func (t *tuiReporter) loop() {
+	defer close(t.done)
+	tick := time.NewTicker(tuiRefresh)
+	defer tick.Stop()
+	for {
+		t.draw()
+		select {
+		case <-t.stop:
+			return
+		case <-tick.C:
+		}
+	}
+}
+
+func (t *tuiReporter) draw() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	cols, rows := terminalSize()
+	width := cols - len("  LOSS ") - 1
+	if width > tuiWindow {
+		width = tuiWindow
+	}
+	color := t.opts.ColorOutput
+
+	var b strings.Builder
+	fmt.Fprintf(&b, msg("tui.header"), programName, version, formatElapsed(time.Since(t.started)))
+
+	for _, tt := range t.targets {
+		r := tt.r
+		s := r.Stats()
+		fmt.Fprintf(&b, "\n%s\n", colorText(displayHost(r)+":"+r.Port(), "1", color))
+
+		last := "-"
+		if tt.last.Seq > 0 {
+			if tt.last.Success() {
+				last = fmt.Sprintf("%.2fms", durMS(tt.last.RTT))
+			} else {
+				last = errorText(errorClassLabel(tcping.ClassifyError(tt.last.Err)), color)
+			}
+		}
+		fmt.Fprintf(&b, msg("tui.last"), tt.last.Seq, last)
+
+		lossRate := 0.0
+		if s.Sent > 0 {
+			lossRate = float64(s.Sent-s.Received) / float64(s.Sent) * 100
+		}
+		fmt.Fprintf(&b, msg("tui.counts"), s.Sent, s.Received, s.Sent-s.Received, lossRate)
+		if s.RTTCount > 0 {
+			fmt.Fprintf(&b, msg("tui.rtt"), durMS(s.Min), durMS(s.Avg), durMS(s.P95), durMS(s.Max), durMS(s.JitterAvg))
+		}
+
+		recent := tt.recent
+		if len(recent) > width {
+			recent = recent[len(recent)-width:]
+		}
+		fmt.Fprintf(&b, "  RTT  %s\n", sparkline(recent, color))
+		fmt.Fprintf(&b, "  LOSS %s\n", lossTimeline(recent, color))
+		if len(s.Failures) > 0 {
+			b.WriteString("  " + fmt.Sprintf(msg("summary.failures"), formatFailures(s.Failures)))
+		}
+	}
+
+	if len(t.errs) > 0 {
+		b.WriteString("\n" + msg("tui.errors"))
+		for i := len(t.errs) - 1; i >= 0; i-- {
+			e := t.errs[i]
+			if e.text != "" {
+				fmt.Fprintf(&b, "  %s  %s  %s\n", formatDisplayTimestamp(e.at), e.target, e.text)
+				continue
+			}
+			fmt.Fprintf(&b, "  %s  %s  seq=%d  %s\n",
+				formatDisplayTimestamp(e.at), e.target, e.seq, errorText(errorClassLabel(e.class), color))
+		}
+	}
+	fmt.Print("\033[H\033[2J" + clipLines(b.String(), msg("tui.quit"), rows))
+}
+
+// clipLines cuts body so that body plus the footer line fits in rows
+// lines; the footer is always shown. The result has no trailing newline so
+// that a full screen does not scroll.
+func clipLines(body, footer string, rows int) string {
+	lines := strings.Split(strings.TrimSuffix(body, "\n"), "\n")
+	lines = append(lines, "", strings.TrimSuffix(footer, "\n"))
+	if len(lines) > rows {
+		lines = append(lines[:max(rows-1, 0)], lines[len(lines)-1])
+	}
+	return strings.Join(lines, "\n")
+}
+
+// sparkline scales successful RTTs between the window's min and max;
+// failed probes are marked with ✗.
+func sparkline(samples []tuiSample, color bool) string {
+	lo, hi := time.Duration(-1), time.Duration(0)
+	for _, s := range samples {
+		if !s.ok {
+			continue
+		}
+		if lo < 0 || s.rtt < lo {
+			lo = s.rtt
+		}
+		if s.rtt > hi {
+			hi = s.rtt
+		}
+	}
+
+	var b strings.Builder
+	for _, s := range samples {
+		if !s.ok {
+			b.WriteString(errorText("✗", color))
+			continue
+		}
+		level := 0
+		if hi > lo {
+			level = int(float64(s.rtt-lo) / float64(hi-lo) * float64(len(sparkLevels)-1))
+		}
+		b.WriteRune(sparkLevels[level])
+	}
+	return b.String()
+}
+
+// lossTimeline shows one cell per probe: · for a reply, ✗ for a loss.
+func lossTimeline(samples []tuiSample, color bool) string {
+	var b strings.Builder
+	for _, s := range samples {
+		if s.ok {
+			b.WriteString(successText("·", color))
+		} else {
+			b.WriteString(errorText("✗", color))
+		}
+	}
+	return b.String()
+}
+
+// terminalSize returns the size of the terminal on stdout, falling back
+// to $COLUMNS and $LINES and then to 80x24 when the kernel cannot tell.
+func terminalSize() (cols, rows int) {
+	if cols, rows, ok := ttySize(); ok {
+		return cols, rows
+	}
+	cols, rows = tuiDefaultCols, tuiDefaultRows
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 10 {
+		cols = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("LINES")); err == nil && n > 2 {
+		rows = n
+	}
+	return cols, rows
+}
+
+func formatElapsed(d time.Duration) string {
+	d = d.Round(time.Second)
+	return fmt.Sprintf("%02d:%02d:%02d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60)
+}
+
+// =====================
+// Held output
+// =====================
+
+// console holds messages written during a run while the dashboard owns
+// the screen and replays them, in order, once the screen is restored. Only
+// the last heldMax messages are kept; the others are counted as dropped.
+var console heldOutput
+
+// stderr is os.Stderr routed through console; use it for anything that
+// may be printed while probes are running.
+var stderr = console.writer(os.Stderr)
+
+type heldOutput struct {
+	mu      sync.Mutex
+	held    bool
+	pending []heldWrite
+	dropped int
+}
+
+type heldWrite struct {
+	w io.Writer
+	p []byte
+}
+
+type heldWriter struct {
+	h *heldOutput
+	w io.Writer
+}
+
+func (h *heldOutput) writer(w io.Writer) io.Writer { return heldWriter{h: h, w: w} }
+
+func (h *heldOutput) hold() {
+	h.mu.Lock()
+	h.held = true
+	h.mu.Unlock()
+}
+
+func (h *heldOutput) release() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.held = false
+	if h.dropped > 0 {
+		fmt.Fprintf(os.Stderr, msg("tui.dropped"), h.dropped)
+	}
+	for _, hw := range h.pending {
+		_, _ = hw.w.Write(hw.p)
+	}
+	h.pending, h.dropped = nil, 0
+}
+
+func (hw heldWriter) Write(p []byte) (int, error) {
+	hw.h.mu.Lock()
+	defer hw.h.mu.Unlock()
+	if hw.h.held {
+		if len(hw.h.pending) == heldMax {
+			hw.h.pending = append(hw.h.pending[:0], hw.h.pending[1:]...)
+			hw.h.dropped++
+		}
+		hw.h.pending = append(hw.h.pending, heldWrite{w: hw.w, p: append([]byte(nil), p...)})
+		return len(p), nil
+	}
+	return hw.w.Write(p)
+}
@@ -0,0 +1,316 @@
+package tcping
+
+import (
+	"math"
+	"math/bits"
+	"sync"
+	"time"
+)
+
+// =====================
+// Statistics (Duration-based)
+// =====================
+
+// Statistics accumulates probe results. It is safe for concurrent use.
+type Statistics struct {
+	mu sync.Mutex
+
+	sentCount      int64
+	respondedCount int64
+	recoveredCount int64 // successes that needed a SYN retransmission
+	rttCount       int64 // successes included in the RTT figures below
+
+	minRTT time.Duration
+	maxRTT time.Duration
+	sumRTT time.Duration
+
+	lastRTT     time.Duration
+	sumJitter   time.Duration
+	jitterCount int64
+
+	// Welford running mean/variance, in nanoseconds.
+	mean float64
+	m2   float64
+
+	hist       rttHistogram
+	rttBuckets [len(RTTBucketBounds)]int64 // per-bucket counts for /metrics
+
+	failures    map[string]int64 // by ClassifyError
+	lastSuccess bool
+
+	initialized bool
+}
+
+// Update records one probe; err == nil means the target responded.
+func (s *Statistics) Update(rtt time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sentCount++
+	s.lastSuccess = err == nil
+	if err != nil {
+		if s.failures == nil {
+			s.failures = make(map[string]int64)
+		}
+		s.failures[ClassifyError(err)]++
+		return
+	}
+	s.respondedCount++
+	s.addRTT(rtt)
+}
+
+// UpdateRecovered records a successful probe whose SYN had to be
+// retransmitted: a loss the connection recovered from. With countRTT false
+// its RTT, inflated by the retransmission timeout, is left out of the RTT
+// figures.
+func (s *Statistics) UpdateRecovered(rtt time.Duration, countRTT bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sentCount++
+	s.lastSuccess = true
+	s.respondedCount++
+	s.recoveredCount++
+	if countRTT {
+		s.addRTT(rtt)
+	}
+}
+
+// addRTT folds one successful RTT into the RTT figures. Caller holds s.mu.
+func (s *Statistics) addRTT(rtt time.Duration) {
+	s.rttCount++
+
+	for i, b := range RTTBucketBounds {
+		if rtt <= b {
+			s.rttBuckets[i]++
+			break
+		}
+	}
+	s.sumRTT += rtt
+
+	x := float64(rtt)
+	delta := x - s.mean
+	s.mean += delta / float64(s.rttCount)
+	s.m2 += delta * (x - s.mean)
+	s.hist.add(rtt)
+
+	if !s.initialized {
+		s.minRTT = rtt
+		s.maxRTT = rtt
+		s.lastRTT = rtt
+		s.initialized = true
+		return
+	}
+
+	j := rtt - s.lastRTT
+	if j < 0 {
+		j = -j
+	}
+	s.sumJitter += j
+	s.jitterCount++
+	s.lastRTT = rtt
+
+	if rtt < s.minRTT {
+		s.minRTT = rtt
+	}
+	if rtt > s.maxRTT {
+		s.maxRTT = rtt
+	}
+}
+
+func (s *Statistics) SentCount() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sentCount
+}
+
+// StatsSnapshot is a point-in-time copy of Statistics.
+type StatsSnapshot struct {
+	Sent      int64
+	Received  int64
+	Recovered int64 // received after a SYN retransmission, see Result.SYNRetransmit
+	Min       time.Duration
+	Max       time.Duration
+	Avg       time.Duration
+	JitterAvg time.Duration
+
+	P50    time.Duration // median
+	P90    time.Duration
+	P95    time.Duration
+	P99    time.Duration
+	StdDev time.Duration // population standard deviation
+	MDev   time.Duration // mean absolute deviation from Avg
+
+	Sum         time.Duration
+	RTTCount    int64            // successes included in the RTT figures
+	RTTBuckets  []int64          // cumulative counts aligned with RTTBucketBounds
+	Failures    map[string]int64 // failed probes by ClassifyError class
+	LastSuccess bool
+}
+
+func (s *Statistics) Snapshot() StatsSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var avg time.Duration
+	if s.rttCount > 0 {
+		avg = time.Duration(s.sumRTT.Nanoseconds() / s.rttCount)
+	}
+
+	var jitterAvg time.Duration
+	if s.jitterCount > 0 {
+		jitterAvg = time.Duration(s.sumJitter.Nanoseconds() / s.jitterCount)
+	}
+
+	var stddev time.Duration
+	if s.rttCount > 0 {
+		stddev = time.Duration(math.Sqrt(s.m2 / float64(s.rttCount)))
+	}
+
+	buckets := make([]int64, len(s.rttBuckets))
+	var cum int64
+	for i, c := range s.rttBuckets {
+		cum += c
+		buckets[i] = cum
+	}
+
+	failures := make(map[string]int64, len(s.failures))
+	for k, v := range s.failures {
+		failures[k] = v
+	}
+
+	return StatsSnapshot{
+		Sent:      s.sentCount,
+		Received:  s.respondedCount,
+		Recovered: s.recoveredCount,
+		Min:       s.minRTT,
+		Max:       s.maxRTT,
+		Avg:       avg,
+		JitterAvg: jitterAvg,
+		P50:       s.percentile(50),
+		P90:       s.percentile(90),
+		P95:       s.percentile(95),
+		P99:       s.percentile(99),
+		StdDev:    stddev,
+		MDev:      min(s.hist.meanAbsDev(s.rttCount, avg), stddev), // MAD never exceeds stddev; clamps bucket rounding
+
+		Sum:         s.sumRTT,
+		RTTCount:    s.rttCount,
+		RTTBuckets:  buckets,
+		Failures:    failures,
+		LastSuccess: s.lastSuccess,
+	}
+}
+
+// percentile returns the histogram estimate clamped to the observed range,
+// so small samples report exact min/max at the tails. Caller holds s.mu.
+func (s *Statistics) percentile(p float64) time.Duration {
+	if s.rttCount == 0 {
+		return 0
+	}
+	v := s.hist.percentile(s.rttCount, p)
+	if v < s.minRTT {
+		v = s.minRTT
+	}
+	if v > s.maxRTT {
+		v = s.maxRTT
+	}
+	return v
+}
+
+// =====================
+// RTT histogram
+// =====================
+
+// rttHistogram is a fixed-size log-linear histogram over microseconds:
+// values below 2^histSubBits get one bucket each, every higher power of two
+// is split into 2^histSubBits linear buckets (~3% relative error). Memory is
+// constant no matter how long the run is.
+const (
+	histSubBits    = 5
+	histSubBuckets = 1 << histSubBits
+	histMaxExp     = 32 // 2^32us is over an hour; larger values are clamped
+	histBuckets    = (histMaxExp - histSubBits + 1) * histSubBuckets
+)
+
+type rttHistogram struct {
+	counts [histBuckets]int64
+}
+
+func histIndex(us uint64) int {
+	if us < histSubBuckets {
+		return int(us)
+	}
+	e := bits.Len64(us) - 1
+	if e >= histMaxExp {
+		return histBuckets - 1
+	}
+	m := us >> (e - histSubBits)
+	return (e-histSubBits+1)*histSubBuckets + int(m-histSubBuckets)
+}
+
+// histBucketMid returns the midpoint of bucket i in microseconds.
+func histBucketMid(i int) float64 {
+	if i < histSubBuckets {
+		return float64(i)
+	}
+	e := i/histSubBuckets + histSubBits - 1
+	m := uint64(i%histSubBuckets + histSubBuckets)
+	width := uint64(1) << (e - histSubBits)
+	return float64(m<<(e-histSubBits)) + float64(width)/2
+}
+
+func (h *rttHistogram) add(d time.Duration) {
+	us := d.Microseconds()
+	if us < 0 {
+		us = 0
+	}
+	h.counts[histIndex(uint64(us))]++
+}
+
+func (h *rttHistogram) percentile(total int64, p float64) time.Duration {
+	rank := int64(math.Ceil(p / 100 * float64(total)))
+	if rank < 1 {
+		rank = 1
+	}
+	var cum int64
+	for i, c := range h.counts {
+		cum += c
+		if cum >= rank {
+			return time.Duration(histBucketMid(i) * float64(time.Microsecond))
+		}
+	}
+	return 0
+}
+
+func (h *rttHistogram) meanAbsDev(total int64, mean time.Duration) time.Duration {
+	if total == 0 {
+		return 0
+	}
+	m := float64(mean.Microseconds())
+	var sum float64
+	for i, c := range h.counts {
+		if c != 0 {
+			sum += float64(c) * math.Abs(histBucketMid(i)-m)
+		}
+	}
+	return time.Duration(sum / float64(total) * float64(time.Microsecond))
+}
+
+// RTTBucketBounds are the upper bounds of StatsSnapshot.RTTBuckets, chosen
+// to suit a Prometheus histogram.
+var RTTBucketBounds = [...]time.Duration{
+	1 * time.Millisecond,
+	2500 * time.Microsecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	1 * time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
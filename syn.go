@@ -0,0 +1,208 @@
+package tcping
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// Port states reported in Result.PortState in SYN mode.
+const (
+	PortOpen     = "open"     // answered with SYN-ACK
+	PortClosed   = "closed"   // answered with RST
+	PortFiltered = "filtered" // no answer within Timeout
+)
+
+// ErrSYNUnsupported is returned in SYN mode on platforms other than Linux.
+var ErrSYNUnsupported = errors.New("SYN mode is only supported on Linux")
+
+// TCP header flags.
+const (
+	tcpFIN = 1 << iota
+	tcpSYN
+	tcpRST
+	tcpPSH
+	tcpACK
+)
+
+const (
+	synWindow = 64240
+	synMSS    = 1460
+)
+
+// CheckSYN reports whether SYN mode can run here for IPv4 targets, or IPv6
+// targets with ipv6 set: it needs Linux, the privilege to open raw sockets
+// (root or CAP_NET_RAW) and, for IPv6, a host with IPv6 enabled.
+func CheckSYN(ipv6 bool) error {
+	unspec, network := net.IPv4zero, "ip4:tcp"
+	if ipv6 {
+		unspec, network = net.IPv6unspecified, "ip6:tcp"
+	}
+	_, release, err := reservePort(unspec, 0)
+	if err != nil {
+		return err
+	}
+	release()
+	c, err := net.ListenPacket(network, unspec.String())
+	if err != nil {
+		return err
+	}
+	return c.Close()
+}
+
+// synProbe sends a single SYN from a raw socket and times the answer. A
+// SYN-ACK is answered with RST, so the target never sees a completed
+// connection. ctx bounds the wait for the answer.
+func (r *Runner) synProbe(ctx context.Context, seq int, ip string) Result {
+	res := Result{Seq: seq, IP: ip}
+	dst := net.ParseIP(ip)
+	dport, _ := strconv.Atoi(r.port)
+	addr := &net.TCPAddr{IP: dst, Port: dport}
+	fail := func(err error) Result {
+		res.Err = &net.OpError{Op: "syn", Net: "tcp", Addr: addr, Err: err}
+		return res
+	}
+
+	src, port, err := r.synSource(ctx, addr)
+	if err != nil {
+		return fail(err)
+	}
+	// Holding the port keeps other connections off it; the kernel answers
+	// the SYN-ACK with its own RST as well, since no socket accepts it.
+	sport, release, err := reservePort(src, port)
+	if err != nil {
+		return fail(err)
+	}
+	defer release()
+
+	network := "ip4:tcp"
+	if dst.To4() == nil {
+		network = "ip6:tcp"
+	}
+	lc := net.ListenConfig{}
+	if r.dialer.Control != nil {
+		lc.Control = r.dialer.Control
+	}
+	c, err := lc.ListenPacket(ctx, network, src.String())
+	if err != nil {
+		return fail(err)
+	}
+	defer c.Close()
+	stop := context.AfterFunc(ctx, func() { _ = c.SetReadDeadline(time.Now()) })
+	defer stop()
+
+	isn := rand.Uint32()
+	syn := tcpSegment(src, dst, sport, dport, isn, 0, tcpSYN, synWindow, true)
+	start := time.Now()
+	if _, err := c.WriteTo(syn, &net.IPAddr{IP: dst}); err != nil {
+		return fail(err)
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := c.ReadFrom(buf)
+		if err != nil {
+			res.RTT = time.Since(start)
+			if ctx.Err() != nil || errors.Is(err, os.ErrDeadlineExceeded) {
+				res.PortState = PortFiltered
+				return fail(os.ErrDeadlineExceeded)
+			}
+			return fail(err)
+		}
+		if ipa, ok := from.(*net.IPAddr); !ok || !ipa.IP.Equal(dst) || n < 20 {
+			continue
+		}
+		seg := buf[:n]
+		if int(binary.BigEndian.Uint16(seg[0:])) != dport || int(binary.BigEndian.Uint16(seg[2:])) != sport ||
+			binary.BigEndian.Uint32(seg[8:]) != isn+1 {
+			continue
+		}
+		flags := seg[13]
+		switch {
+		case flags&(tcpSYN|tcpACK) == tcpSYN|tcpACK:
+			res.RTT = time.Since(start)
+			res.PortState = PortOpen
+			res.LocalAddr = net.JoinHostPort(src.String(), strconv.Itoa(sport))
+			rst := tcpSegment(src, dst, sport, dport, isn+1, 0, tcpRST, 0, false)
+			_, _ = c.WriteTo(rst, &net.IPAddr{IP: dst})
+			return res
+		case flags&tcpRST != 0:
+			res.RTT = time.Since(start)
+			res.PortState = PortClosed
+			return fail(syscall.ECONNREFUSED)
+		}
+	}
+}
+
+// synSource picks the local address and port for a SYN probe: Source when
+// set (port 0 unless it names one), otherwise whatever the routing table
+// (and Interface) would use, found by connecting a UDP socket, which sends
+// nothing.
+func (r *Runner) synSource(ctx context.Context, dst *net.TCPAddr) (net.IP, int, error) {
+	if src, _ := ParseSourceAddr(r.cfg.Source); src != nil {
+		return src.IP, src.Port, nil
+	}
+	d := net.Dialer{Control: r.dialer.Control}
+	c, err := d.DialContext(ctx, "udp", dst.String())
+	if err != nil {
+		return nil, 0, err
+	}
+	defer c.Close()
+	return c.LocalAddr().(*net.UDPAddr).IP, 0, nil
+}
+
+// tcpSegment builds a TCP header, with an MSS option when withMSS is set,
+// and fills in the checksum over the IPv4 or IPv6 pseudo-header.
+func tcpSegment(src, dst net.IP, sport, dport int, seq, ack uint32, flags byte, window uint16, withMSS bool) []byte {
+	hlen := 20
+	if withMSS {
+		hlen += 4
+	}
+	b := make([]byte, hlen)
+	binary.BigEndian.PutUint16(b[0:], uint16(sport))
+	binary.BigEndian.PutUint16(b[2:], uint16(dport))
+	binary.BigEndian.PutUint32(b[4:], seq)
+	binary.BigEndian.PutUint32(b[8:], ack)
+	b[12] = byte(hlen/4) << 4
+	b[13] = flags
+	binary.BigEndian.PutUint16(b[14:], window)
+	if withMSS {
+		b[20], b[21] = 2, 4
+		binary.BigEndian.PutUint16(b[22:], synMSS)
+	}
+	binary.BigEndian.PutUint16(b[16:], tcpChecksum(src, dst, b))
+	return b
+}
+
+func tcpChecksum(src, dst net.IP, seg []byte) uint16 {
+	var pseudo []byte
+	if s4, d4 := src.To4(), dst.To4(); s4 != nil && d4 != nil {
+		pseudo = append(append(pseudo, s4...), d4...)
+		pseudo = append(pseudo, 0, syscall.IPPROTO_TCP)
+		pseudo = binary.BigEndian.AppendUint16(pseudo, uint16(len(seg)))
+	} else {
+		pseudo = append(append(pseudo, src.To16()...), dst.To16()...)
+		pseudo = binary.BigEndian.AppendUint32(pseudo, uint32(len(seg)))
+		pseudo = append(pseudo, 0, 0, 0, syscall.IPPROTO_TCP)
+	}
+
+	var sum uint32
+	for _, data := range [][]byte{pseudo, seg} {
+		for i := 0; i+1 < len(data); i += 2 {
+			sum += uint32(binary.BigEndian.Uint16(data[i:]))
+		}
+		if len(data)%2 == 1 {
+			sum += uint32(data[len(data)-1]) << 8
+		}
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	return ^uint16(sum)
+}
@@ -0,0 +1,48 @@
+package tcping
+
+import (
+	"net"
+	"time"
+)
+
+// TCPInfo is the kernel's view of a probe connection (Linux TCP_INFO). It
+// is read right after connect and again after the TLS handshake in TLS
+// mode; it is nil on other platforms.
+type TCPInfo struct {
+	SRTT           time.Duration // smoothed RTT estimate
+	RTTVar         time.Duration // RTT variance
+	Retransmits    uint32        // segments retransmitted, SYNs included
+	SYNRetransmits uint32        // SYNs retransmitted before the connect succeeded, from Retransmits at connect time
+	MSS            uint32        // send MSS
+	PMTU           uint32        // path MTU
+}
+
+// readTCPInfo returns nil when conn is not a TCP connection or the
+// platform has no TCP_INFO.
+func readTCPInfo(conn net.Conn) *TCPInfo {
+	tc, ok := conn.(*net.TCPConn)
+	if !ok {
+		return nil
+	}
+	rc, err := tc.SyscallConn()
+	if err != nil {
+		return nil
+	}
+	var info *TCPInfo
+	if err := rc.Control(func(fd uintptr) { info = getTCPInfo(fd) }); err != nil {
+		return nil
+	}
+	return info
+}
+
+// refresh re-reads the counters that keep changing after connect, keeping
+// SYNRetransmits from the connect-time snapshot.
+func (ti *TCPInfo) refresh(conn net.Conn) {
+	if ti == nil {
+		return
+	}
+	if now := readTCPInfo(conn); now != nil {
+		now.SYNRetransmits = ti.SYNRetransmits
+		*ti = *now
+	}
+}
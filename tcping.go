@@ -0,0 +1,861 @@
+// Package tcping measures TCP connect latency to a host, optionally
+// followed by a TLS handshake and an HTTP request on the same connection.
+//
+// A Runner probes one target on a fixed interval; a Group runs several
+// Runners at once. Results are delivered through the callbacks in Config
+// and aggregated into a StatsSnapshot:
+//
+//	r := tcping.NewRunner(&tcping.Config{
+//		Count: 5,
+//		OnResult: func(r *tcping.Runner, res tcping.Result) {
+//			fmt.Println(res.Seq, res.IP, res.RTT, res.Err)
+//		},
+//	}, "example.com", "443")
+//	stats, err := r.Run(ctx)
+package tcping
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Defaults applied to zero Config fields.
+const (
+	DefaultInterval   = 1 * time.Second
+	DefaultTimeout    = 1 * time.Second
+	DefaultDNSTimeout = 1500 * time.Millisecond
+)
+
+// SYNRetransmitRTT is the connect time from which a probe without TCP_INFO
+// is assumed to have needed a SYN retransmission: common stacks resend an
+// unanswered SYN after an initial timeout of one second.
+const SYNRetransmitRTT = 1 * time.Second
+
+// AllIPs modes.
+const (
+	AllIPsRoundRobin = "rr"   // rotate through the resolved addresses
+	AllIPsEach       = "each" // probe every address on every interval
+)
+
+// Re-resolution reasons reported in ResolveEvent.
+const (
+	ReasonInterval = "interval"
+	ReasonFailures = "failures"
+)
+
+// ErrNoTargets is returned by Group.Run when no target could be started.
+var ErrNoTargets = errors.New("no target could be started")
+
+// Config controls how targets are probed. Zero durations take the
+// defaults above. A Config may be shared by several Runners but must not
+// be modified while they run.
+type Config struct {
+	UseIPv4    bool
+	UseIPv6    bool
+	Count      int           // 0 = infinite
+	Interval   time.Duration // ping interval
+	Timeout    time.Duration // per-stage timeout: dial, TLS handshake, HTTP request
+	DNSTimeout time.Duration // dns lookup timeout
+	DNSServer  string        // optional DNS server, "ip" or "ip:port"
+	AllIPs     string        // "", AllIPsRoundRobin or AllIPsEach
+
+	// Source is the local address probes are sent from, "ip" or "ip:port"
+	// (see ParseSourceAddr); it also selects the address family when
+	// neither UseIPv4 nor UseIPv6 is set. Interface binds probes to a
+	// network interface by name (Linux only).
+	Source    string
+	Interface string
+
+	// Socket options applied before connect, Linux only; zero keeps the
+	// system default. TOS is the IPv4 TOS byte or IPv6 traffic class
+	// (DSCP << 2), TTL the IPv4 TTL or IPv6 hop limit, and Mark the SO_MARK
+	// value matched by policy routing rules.
+	TOS  int
+	TTL  int
+	Mark uint32
+
+	ReResolve         time.Duration // re-resolve the host this often, 0 = never
+	ReResolveFailures int           // re-resolve after N consecutive failures, 0 = never
+
+	Concurrency int // max probes in flight across a Group, 0 = unlimited
+
+	// ExcludeRecovered leaves probes that needed a SYN retransmission out
+	// of the RTT statistics; they are still counted as received and as
+	// StatsSnapshot.Recovered.
+	ExcludeRecovered bool
+
+	// SYN probes with a half-open handshake instead of a full connect: a
+	// SYN is sent from a raw socket, the SYN-ACK or RST is timed, and an
+	// open port is answered with RST. Linux only, needs root or
+	// CAP_NET_RAW; TLS and HTTP do not apply. See CheckSYN.
+	SYN bool
+
+	// InFlight > 0 switches a Runner to fixed-rate scheduling: a probe is
+	// started every Interval regardless of how long earlier probes take,
+	// with up to InFlight of them running at once. Results may then arrive
+	// out of Seq order. 0 waits for each probe before the next interval.
+	InFlight int
+
+	TLS         bool     // perform a TLS handshake after connect
+	SNI         string   // TLS server name, defaults to the target host
+	ALPN        []string // offered ALPN protocols
+	TLSInsecure bool     // skip certificate verification
+
+	HTTP       bool          // send an HTTP request after connect (and TLS)
+	HTTPMethod string        // request method, default GET
+	HTTPPath   string        // request path, may include a query
+	HTTPHost   string        // Host header override
+	HTTPHeader http.Header   // extra request headers
+	HTTPExpect []StatusRange // status codes counted as success, default 200-399
+	UserAgent  string        // default "tcping"
+
+	// The callbacks below are optional. OnResult and OnResolve may be called
+	// from several goroutines at once in AllIPsEach mode, with InFlight and
+	// in a Group.
+
+	OnStart   func(r *Runner)                  // after the initial resolution
+	OnResult  func(r *Runner, res Result)      // after every probe
+	OnResolve func(r *Runner, ev ResolveEvent) // when re-resolution changes addresses or fails
+	OnError   func(r *Runner, err error)       // when a Group target cannot be started
+}
+
+func (c *Config) withDefaults() *Config {
+	cfg := *c
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultInterval
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.DNSTimeout <= 0 {
+		cfg.DNSTimeout = DefaultDNSTimeout
+	}
+	if cfg.HTTPMethod == "" {
+		cfg.HTTPMethod = http.MethodGet
+	}
+	if cfg.HTTPPath == "" {
+		cfg.HTTPPath = "/"
+	}
+	if len(cfg.HTTPExpect) == 0 {
+		cfg.HTTPExpect = []StatusRange{{200, 399}}
+	}
+	if cfg.UserAgent == "" {
+		cfg.UserAgent = "tcping"
+	}
+	if src, err := ParseSourceAddr(cfg.Source); err == nil && src != nil && !cfg.UseIPv4 && !cfg.UseIPv6 {
+		cfg.UseIPv4 = src.IP.To4() != nil
+		cfg.UseIPv6 = !cfg.UseIPv4
+	}
+	return &cfg
+}
+
+// Result is the outcome of one probe.
+type Result struct {
+	Seq       int
+	Time      time.Time     // when the probe completed
+	IP        string        // address probed
+	RTT       time.Duration // TCP connect time
+	LocalAddr string        // empty when the connect failed
+	TCPInfo   *TCPInfo      // kernel connection stats, Linux only
+	TLS       *TLSInfo      // set in TLS mode once the handshake ran
+	HTTP      *HTTPInfo     // set in HTTP mode once the request ran
+	Err       error         // nil on success; see ClassifyError
+
+	// PortState is PortOpen, PortClosed or PortFiltered in SYN mode and
+	// empty otherwise.
+	PortState string
+
+	// SYNRetransmit is set when the connect only succeeded after a SYN
+	// was retransmitted, per TCPInfo or, without it, an RTT of at least
+	// SYNRetransmitRTT.
+	SYNRetransmit bool
+}
+
+func (res Result) Success() bool { return res.Err == nil }
+
+// ResolveEvent is reported when re-resolution changes the addresses or fails.
+type ResolveEvent struct {
+	Time   time.Time
+	Reason string   // ReasonInterval or ReasonFailures
+	OldIP  string   // previously probed address
+	NewIP  string   // address probed from now on
+	IPs    []string // full new resolution result
+	Err    error    // set when the lookup failed; old addresses are kept
+}
+
+// IPStats is the per-address breakdown returned by Runner.PerIP.
+type IPStats struct {
+	IP    string
+	Stats StatsSnapshot
+}
+
+// Target is one host and port to probe.
+type Target struct {
+	Host string
+	Port string
+}
+
+// =====================
+// Runner
+// =====================
+
+type Runner struct {
+	cfg *Config
+
+	host string
+	port string
+
+	// mu guards the resolution results below, which re-resolution may
+	// replace while probes and readers such as a metrics handler use them.
+	mu sync.RWMutex
+
+	chosenIP string // display + dial (JoinHostPort will bracket IPv6)
+	ipType   string
+	allIPs   []net.IP
+
+	probeIPs []string               // rotation pool in AllIPs mode
+	ipStats  map[string]*Statistics // per-address stats in AllIPs mode
+	statIPs  []string               // every address ever probed, in order
+
+	lastResolve time.Time
+	dnsTime     time.Duration
+	consecFails atomic.Int64
+	resolving   atomic.Bool // a fixed-rate re-resolution is in flight
+
+	stats    *Statistics
+	tlsStats *Statistics // handshake durations in TLS mode
+	http     *httpStats
+
+	sem    chan struct{} // shared probe slots, nil = unlimited
+	dialer *net.Dialer   // set by Run from Source and Interface
+}
+
+func NewRunner(cfg *Config, host, port string) *Runner {
+	return &Runner{
+		cfg:      cfg.withDefaults(),
+		host:     host,
+		port:     port,
+		stats:    &Statistics{},
+		tlsStats: &Statistics{},
+		http:     &httpStats{},
+	}
+}
+
+func (r *Runner) Host() string { return r.host }
+func (r *Runner) Port() string { return r.port }
+
+func (r *Runner) Target() string {
+	return net.JoinHostPort(r.host, r.port)
+}
+
+// IP returns the address currently probed, empty before resolution.
+func (r *Runner) IP() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.chosenIP
+}
+
+// IPType returns "IPv4" or "IPv6" for IP.
+func (r *Runner) IPType() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.ipType
+}
+
+// Addrs returns every address the host resolved to.
+func (r *Runner) Addrs() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return ipStrings(r.allIPs)
+}
+
+// ProbeIPs returns the addresses probed in AllIPs mode.
+func (r *Runner) ProbeIPs() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return slices.Clone(r.probeIPs)
+}
+
+// DNSTime returns how long the last lookup took; zero for IP targets.
+func (r *Runner) DNSTime() time.Duration {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.dnsTime
+}
+
+// ServerName returns the TLS server name sent in TLS mode.
+func (r *Runner) ServerName() string {
+	if r.cfg.SNI != "" {
+		return r.cfg.SNI
+	}
+	return r.host
+}
+
+func (r *Runner) Stats() StatsSnapshot    { return r.stats.Snapshot() }
+func (r *Runner) TLSStats() StatsSnapshot { return r.tlsStats.Snapshot() }
+func (r *Runner) HTTPStats() HTTPSnapshot { return r.http.snapshot() }
+func (r *Runner) SentCount() int64        { return r.stats.SentCount() }
+
+// PerIP returns per-address stats in AllIPs mode, otherwise the overall
+// stats under the probed address.
+func (r *Runner) PerIP() []IPStats {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.cfg.AllIPs == "" {
+		return []IPStats{{IP: r.chosenIP, Stats: r.stats.Snapshot()}}
+	}
+	rows := make([]IPStats, 0, len(r.statIPs))
+	for _, ip := range r.statIPs {
+		rows = append(rows, IPStats{IP: ip, Stats: r.ipStats[ip].Snapshot()})
+	}
+	return rows
+}
+
+// Run resolves the host and probes it every Interval until Count probes
+// were sent or ctx is done, then returns the final stats. A cancelled run
+// returns ctx.Err() together with the stats gathered so far.
+func (r *Runner) Run(ctx context.Context) (StatsSnapshot, error) {
+	dialer, err := r.cfg.newDialer()
+	if err != nil {
+		return r.Stats(), err
+	}
+	r.dialer = dialer
+	if err := r.resolve(ctx); err != nil {
+		return r.Stats(), err
+	}
+	if r.cfg.OnStart != nil {
+		r.cfg.OnStart(r)
+	}
+	if r.cfg.InFlight > 0 {
+		return r.runFixedRate(ctx)
+	}
+
+	ticker := time.NewTicker(r.cfg.Interval)
+	defer ticker.Stop()
+
+	for seq := 1; r.cfg.Count == 0 || seq <= r.cfg.Count; seq++ {
+		select {
+		case <-ctx.Done():
+			return r.Stats(), ctx.Err()
+		default:
+		}
+
+		r.probeTick(ctx, seq)
+
+		if r.cfg.Count > 0 && seq == r.cfg.Count {
+			break
+		}
+
+		r.maybeReResolve(ctx)
+
+		select {
+		case <-ctx.Done():
+			return r.Stats(), ctx.Err()
+		case <-ticker.C:
+		}
+	}
+
+	return r.Stats(), nil
+}
+
+// runFixedRate starts probe seq at start + (seq-1)*Interval, so a probe
+// that times out does not delay the ones after it. When all InFlight slots
+// are busy the next probe waits for one and the schedule catches up once
+// it is free. Seq numbers are assigned when a probe is started.
+func (r *Runner) runFixedRate(ctx context.Context) (StatsSnapshot, error) {
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, r.cfg.InFlight)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	// A lookup still running when the last probe finishes is abandoned
+	// rather than holding up the summary.
+	var resolveWG sync.WaitGroup
+	resolveCtx, cancelResolve := context.WithCancel(ctx)
+	defer func() {
+		cancelResolve()
+		resolveWG.Wait()
+	}()
+
+	start := time.Now()
+	for seq := 1; r.cfg.Count == 0 || seq <= r.cfg.Count; seq++ {
+		if seq > 1 {
+			r.maybeReResolveAsync(resolveCtx, &resolveWG)
+
+			timer.Reset(time.Until(start.Add(time.Duration(seq-1) * r.cfg.Interval)))
+			select {
+			case <-ctx.Done():
+				wg.Wait()
+				return r.Stats(), ctx.Err()
+			case <-timer.C:
+			}
+		}
+
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return r.Stats(), ctx.Err()
+		}
+		wg.Add(1)
+		go func(seq int) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			r.probeTick(ctx, seq)
+		}(seq)
+	}
+
+	wg.Wait()
+	return r.Stats(), nil
+}
+
+// probeTick sends the probes for one interval: the chosen address, the
+// next address in rotation, or every address at once.
+func (r *Runner) probeTick(ctx context.Context, seq int) {
+	r.mu.RLock()
+	chosen, pool := r.chosenIP, r.probeIPs
+	r.mu.RUnlock()
+
+	switch r.cfg.AllIPs {
+	case AllIPsRoundRobin:
+		r.pingOnce(ctx, seq, pool[(seq-1)%len(pool)])
+	case AllIPsEach:
+		var wg sync.WaitGroup
+		for _, ip := range pool {
+			wg.Add(1)
+			go func(ip string) {
+				defer wg.Done()
+				r.pingOnce(ctx, seq, ip)
+			}(ip)
+		}
+		wg.Wait()
+	default:
+		r.pingOnce(ctx, seq, chosen)
+	}
+}
+
+func (r *Runner) pingOnce(ctx context.Context, seq int, ip string) {
+	if r.sem != nil {
+		select {
+		case r.sem <- struct{}{}:
+			defer func() { <-r.sem }()
+		case <-ctx.Done():
+			return
+		}
+	}
+
+	// In HTTP mode every probe looks the host up first, as an HTTP client
+	// would, so that DNS is timed per probe. The request still goes to ip
+	// to keep rotation and per-address stats intact.
+	var dnsTime time.Duration
+	if r.cfg.HTTP {
+		var err error
+		if _, _, dnsTime, err = r.lookup(ctx); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			r.recordResult(ip, Result{Seq: seq, IP: ip, Time: time.Now(), Err: err, HTTP: &HTTPInfo{DNS: dnsTime}})
+			return
+		}
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, r.cfg.Timeout)
+	defer cancel()
+
+	var res Result
+	if r.cfg.SYN {
+		res = r.synProbe(dialCtx, seq, ip)
+	} else {
+		res = r.connect(ctx, dialCtx, seq, ip, dnsTime)
+	}
+
+	if ctx.Err() != nil {
+		return
+	}
+	res.Time = time.Now()
+	r.recordResult(ip, res)
+}
+
+// connect is a full TCP connect, followed by the TLS handshake or HTTP
+// request when configured. dnsTime is the lookup that preceded it in HTTP
+// mode.
+func (r *Runner) connect(ctx, dialCtx context.Context, seq int, ip string, dnsTime time.Duration) Result {
+	start := time.Now()
+	conn, err := r.dialer.DialContext(dialCtx, "tcp", net.JoinHostPort(ip, r.port))
+	res := Result{Seq: seq, IP: ip, RTT: time.Since(start), Err: err}
+
+	if conn != nil {
+		res.LocalAddr = conn.LocalAddr().String()
+		res.TCPInfo = readTCPInfo(conn)
+		if res.TCPInfo != nil {
+			res.SYNRetransmit = res.TCPInfo.SYNRetransmits > 0
+		} else {
+			res.SYNRetransmit = res.RTT >= SYNRetransmitRTT
+		}
+	}
+
+	switch {
+	case err != nil:
+	case r.cfg.HTTP:
+		// The HTTP transport takes ownership of conn and closes it.
+		res.HTTP, res.TLS, res.Err = r.httpProbe(ctx, conn, start.Add(-dnsTime))
+		res.HTTP.DNS = dnsTime
+		conn = nil
+	case r.cfg.TLS:
+		raw := conn
+		conn, res.TLS, res.Err = r.tlsHandshake(ctx, conn)
+		res.TCPInfo.refresh(raw)
+	}
+	if conn != nil {
+		_ = conn.Close()
+	}
+	return res
+}
+
+// recordResult updates the statistics and reports res.
+func (r *Runner) recordResult(ip string, res Result) {
+	r.record(r.stats, res)
+	r.mu.RLock()
+	ipStats := r.ipStats[ip]
+	r.mu.RUnlock()
+	if ipStats != nil {
+		r.record(ipStats, res)
+	}
+	if res.Success() {
+		r.consecFails.Store(0)
+	} else {
+		r.consecFails.Add(1)
+	}
+	if res.TLS != nil {
+		var tlsErr error
+		if IsTLSError(res.Err) {
+			tlsErr = res.Err
+		}
+		r.tlsStats.Update(res.TLS.Handshake, tlsErr)
+	}
+	if res.HTTP != nil {
+		r.http.record(res.HTTP, res.Err)
+	}
+
+	if r.cfg.OnResult != nil {
+		r.cfg.OnResult(r, res)
+	}
+}
+
+// record adds res to s, keeping successes that needed a SYN retransmission
+// apart as recovered loss.
+func (r *Runner) record(s *Statistics, res Result) {
+	if res.Success() && res.SYNRetransmit {
+		s.UpdateRecovered(res.RTT, !r.cfg.ExcludeRecovered)
+		return
+	}
+	s.Update(res.RTT, res.Err)
+}
+
+// =====================
+// Resolution
+// =====================
+
+func (r *Runner) resolve(ctx context.Context) error {
+	ips, chosen, dnsTime, err := r.lookup(ctx)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.allIPs = ips
+	r.dnsTime = dnsTime
+	r.chooseIP(chosen)
+	r.setProbeIPs()
+	r.lastResolve = time.Now()
+	return nil
+}
+
+// lookup resolves r.host and picks the address to probe. It does not touch
+// the runner state so that a failed re-resolution keeps the old addresses.
+func (r *Runner) lookup(ctx context.Context) (ips []net.IP, chosen net.IP, dnsTime time.Duration, err error) {
+	if ip := net.ParseIP(r.host); ip != nil {
+		isV4 := ip.To4() != nil
+		if r.cfg.UseIPv4 && !isV4 {
+			return nil, nil, 0, &ResolveError{Host: r.host, Err: ErrNotIPv4}
+		}
+		if r.cfg.UseIPv6 && isV4 {
+			return nil, nil, 0, &ResolveError{Host: r.host, Err: ErrNotIPv6}
+		}
+		return []net.IP{ip}, ip, 0, nil
+	}
+
+	dnsCtx, cancel := context.WithTimeout(ctx, r.cfg.DNSTimeout)
+	defer cancel()
+
+	res := net.Resolver{}
+	server := dnsServerAddr(r.cfg.DNSServer)
+	if server != "" {
+		dialer := &net.Dialer{Timeout: r.cfg.DNSTimeout}
+		res = net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, server)
+			},
+		}
+	}
+
+	dnsStart := time.Now()
+	ipAddrs, err := res.LookupIPAddr(dnsCtx, r.host)
+	dnsTime = time.Since(dnsStart)
+	if err != nil {
+		return nil, nil, dnsTime, &ResolveError{Host: r.host, Server: server, Err: err}
+	}
+	if len(ipAddrs) == 0 {
+		return nil, nil, dnsTime, &ResolveError{Host: r.host, Server: server, Err: ErrNoAddress}
+	}
+
+	ips = make([]net.IP, 0, len(ipAddrs))
+	for _, a := range ipAddrs {
+		ips = append(ips, a.IP)
+	}
+
+	wantV4 := func(ip net.IP) bool { return ip.To4() != nil }
+	wantV6 := func(ip net.IP) bool { return ip.To4() == nil }
+	switch {
+	case r.cfg.UseIPv4:
+		if chosen = firstIP(ips, wantV4); chosen == nil {
+			return nil, nil, dnsTime, &ResolveError{Host: r.host, Server: server, Err: ErrNoIPv4Address}
+		}
+	case r.cfg.UseIPv6:
+		if chosen = firstIP(ips, wantV6); chosen == nil {
+			return nil, nil, dnsTime, &ResolveError{Host: r.host, Server: server, Err: ErrNoIPv6Address}
+		}
+	default:
+		// Prefer IPv4 when both families are available.
+		if chosen = firstIP(ips, wantV4); chosen == nil {
+			chosen = firstIP(ips, wantV6)
+		}
+	}
+
+	return ips, chosen, dnsTime, nil
+}
+
+func firstIP(ips []net.IP, match func(net.IP) bool) net.IP {
+	for _, ip := range ips {
+		if match(ip) {
+			return ip
+		}
+	}
+	return nil
+}
+
+// dnsServerAddr adds the default port to a DNS server given as a bare IP.
+func dnsServerAddr(s string) string {
+	if s == "" {
+		return ""
+	}
+	if _, _, err := net.SplitHostPort(s); err == nil {
+		return s
+	}
+	return net.JoinHostPort(s, "53")
+}
+
+// maybeReResolve refreshes the addresses when ReResolve is due or after
+// ReResolveFailures consecutive failures. Literal IP targets never change.
+func (r *Runner) maybeReResolve(ctx context.Context) {
+	if reason := r.reResolveReason(); reason != "" {
+		r.reResolve(ctx, reason)
+	}
+}
+
+// maybeReResolveAsync is maybeReResolve for the fixed-rate scheduler: the
+// lookup runs in its own goroutine, tracked by wg, so a slow resolver never
+// delays a probe start. At most one lookup is in flight; probes keep using
+// the old addresses until it swaps them in.
+func (r *Runner) maybeReResolveAsync(ctx context.Context, wg *sync.WaitGroup) {
+	if !r.resolving.CompareAndSwap(false, true) {
+		return
+	}
+	reason := r.reResolveReason()
+	if reason == "" {
+		r.resolving.Store(false)
+		return
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer r.resolving.Store(false)
+		r.reResolve(ctx, reason)
+	}()
+}
+
+// reResolveReason reports why addresses should be refreshed now, or ""
+// when they should not. A failures trigger resets the failure count.
+func (r *Runner) reResolveReason() string {
+	if net.ParseIP(r.host) != nil {
+		return ""
+	}
+	if n := r.cfg.ReResolveFailures; n > 0 && r.consecFails.Load() >= int64(n) {
+		r.consecFails.Store(0)
+		return ReasonFailures
+	}
+	if r.cfg.ReResolve > 0 {
+		r.mu.RLock()
+		due := time.Since(r.lastResolve) >= r.cfg.ReResolve
+		r.mu.RUnlock()
+		if due {
+			return ReasonInterval
+		}
+	}
+	return ""
+}
+
+func (r *Runner) reResolve(ctx context.Context, reason string) {
+	ips, chosen, dnsTime, err := r.lookup(ctx)
+	if ctx.Err() != nil {
+		return
+	}
+
+	r.mu.Lock()
+	r.lastResolve = time.Now()
+	if err != nil {
+		r.mu.Unlock()
+		r.reportResolve(ResolveEvent{Time: time.Now(), Reason: reason, Err: err})
+		return
+	}
+	oldIP, oldPool := r.chosenIP, ipStrings(r.allIPs)
+	r.allIPs = ips
+	r.dnsTime = dnsTime
+	r.chooseIP(chosen)
+	r.setProbeIPs()
+	newIP, newPool := r.chosenIP, ipStrings(r.allIPs)
+	r.mu.Unlock()
+
+	if oldIP == newIP && slices.Equal(oldPool, newPool) {
+		return
+	}
+	r.reportResolve(ResolveEvent{Time: time.Now(), Reason: reason, OldIP: oldIP, NewIP: newIP, IPs: newPool})
+}
+
+func (r *Runner) reportResolve(ev ResolveEvent) {
+	if r.cfg.OnResolve != nil {
+		r.cfg.OnResolve(r, ev)
+	}
+}
+
+func ipStrings(ips []net.IP) []string {
+	out := make([]string, len(ips))
+	for i, ip := range ips {
+		out[i] = ip.String()
+	}
+	return out
+}
+
+// setProbeIPs builds the AllIPs pool from allIPs, honouring UseIPv4/UseIPv6.
+// Stats of addresses that drop out of DNS are kept for the summary.
+// Caller holds r.mu.
+func (r *Runner) setProbeIPs() {
+	if r.cfg.AllIPs == "" {
+		return
+	}
+	if r.ipStats == nil {
+		r.ipStats = make(map[string]*Statistics)
+	}
+	pool := make([]string, 0, len(r.allIPs))
+	for _, ip := range r.allIPs {
+		isV4 := ip.To4() != nil
+		if r.cfg.UseIPv4 && !isV4 || r.cfg.UseIPv6 && isV4 {
+			continue
+		}
+		s := ip.String()
+		if slices.Contains(pool, s) {
+			continue
+		}
+		pool = append(pool, s)
+		if r.ipStats[s] == nil {
+			r.ipStats[s] = &Statistics{}
+			r.statIPs = append(r.statIPs, s)
+		}
+	}
+	r.probeIPs = pool
+}
+
+func (r *Runner) chooseIP(ip net.IP) {
+	if ip.To4() != nil {
+		r.ipType = "IPv4"
+	} else {
+		r.ipType = "IPv6"
+	}
+	r.chosenIP = ip.String()
+}
+
+// =====================
+// Group
+// =====================
+
+// Group probes several targets concurrently with a shared Config.
+type Group struct {
+	cfg     *Config
+	runners []*Runner
+}
+
+func NewGroup(cfg *Config, targets []Target) *Group {
+	g := &Group{cfg: cfg}
+
+	var sem chan struct{}
+	if cfg.Concurrency > 0 {
+		sem = make(chan struct{}, cfg.Concurrency)
+	}
+
+	for _, t := range targets {
+		r := NewRunner(cfg, t.Host, t.Port)
+		r.sem = sem
+		g.runners = append(g.runners, r)
+	}
+	return g
+}
+
+func (g *Group) Runners() []*Runner { return g.runners }
+
+func (g *Group) SentCount() int64 {
+	var n int64
+	for _, r := range g.runners {
+		n += r.SentCount()
+	}
+	return n
+}
+
+// Run probes every target concurrently until all runners finish. A target
+// that fails to resolve is reported through OnError and skipped; Run only
+// fails when no target could be started at all.
+func (g *Group) Run(ctx context.Context) error {
+	var (
+		wg     sync.WaitGroup
+		failed atomic.Int64
+	)
+	for _, r := range g.runners {
+		wg.Add(1)
+		go func(r *Runner) {
+			defer wg.Done()
+			if _, err := r.Run(ctx); err != nil && ctx.Err() == nil {
+				failed.Add(1)
+				if g.cfg.OnError != nil {
+					g.cfg.OnError(r, err)
+				}
+			}
+		}(r)
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if failed.Load() == int64(len(g.runners)) {
+		return ErrNoTargets
+	}
+	return nil
+}
@@ -1,7 +1,7 @@
 #!/bin/bash
 
 # 源代码路径
-SRC_PATH="./src/main.go"
+SRC_PATH="./src"
 # 输出目录
 OUT_DIR="./bin"
 # 程序名